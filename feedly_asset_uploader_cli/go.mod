@@ -0,0 +1,17 @@
+module github.com/Palaract/feedly_asset_sync/feedly_asset_uploader_cli
+
+go 1.21
+
+require (
+	github.com/Palaract/feedly_asset_sync v0.0.0
+	github.com/fsnotify/fsnotify v1.7.0
+)
+
+require (
+	golang.org/x/sys v0.5.0 // indirect
+	golang.org/x/text v0.15.0 // indirect
+	golang.org/x/time v0.5.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/Palaract/feedly_asset_sync => ../
@@ -1,241 +1,554 @@
 package main
 
 import (
-	"encoding/csv"
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"sort"
 	"strings"
+	"syscall"
+	"text/tabwriter"
 	"time"
+
+	"github.com/Palaract/feedly_asset_sync/internal/feedly"
 )
 
-type Config struct {
-	UploadURL string `json:"upload_url"`
-	APIKey    string `json:"api_key"` 
-	CSVPath   string `json:"csv_path"`
-}
+// Exit statuses, so that scripts can tell the kinds of failure apart. An
+// invalid config or command line exits with 1, like log.Fatal.
+const (
+	// exitCodeFailed is used when nothing could be synced.
+	exitCodeFailed = 2
+	// exitCodePartial is used when some lists were synced and others failed.
+	exitCodePartial = 3
+	// exitCodeAuth is used when Feedly rejects the API key.
+	exitCodeAuth = 4
+)
 
-type FeedlyEntity struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
-}
+// errNotConfirmed is returned when the changes of a sync were not
+// confirmed.
+var errNotConfirmed = errors.New("aborted")
 
-type FeedlyList struct {
-	ID       string         `json:"id,omitempty"`
-	Label    string         `json:"label"`
-	Type     string         `json:"type"`
-	Entities []FeedlyEntity `json:"entities"`
-}
+// version is reported in the default User-Agent. Release builds set it with
+// -ldflags "-X main.version=1.2.3".
+var version = "dev"
 
-func loadConfig() (Config, error) {
-	var config Config
-	file, err := os.Open("config.json")
+// ExportToCSV fetches the current Feedly lists and writes them to path in
+// the CSV format the sync consumes, so an unchanged export re-uploads as a
+// no-op.
+func ExportToCSV(ctx context.Context, client *http.Client, config feedly.Config, path string) error {
+	feedlyData, err := feedly.FetchFeedlyData(ctx, client, config)
 	if err != nil {
-		return config, fmt.Errorf("error opening config: %v", err)
+		return err
 	}
-	defer file.Close()
 
-	if err := json.NewDecoder(file).Decode(&config); err != nil {
-		return config, fmt.Errorf("error decoding config: %v", err)
-	}
-	return config, nil
-}
-
-func readCSVData(filename string) (map[string][]string, error) {
-	file, err := os.Open(filename)
+	file, err := os.Create(path)
 	if err != nil {
-		return nil, fmt.Errorf("error opening CSV: %v", err)
+		return fmt.Errorf("error creating export file: %v", err)
 	}
 	defer file.Close()
 
-	reader := csv.NewReader(file)
-	headers, err := reader.Read()
-	if err != nil {
-		return nil, fmt.Errorf("error reading CSV headers: %v", err)
+	if err := feedly.WriteListsCSV(file, feedlyData, config); err != nil {
+		return err
 	}
+	feedly.LogInfof("Exported %d lists to %s", len(feedlyData), path)
+	return nil
+}
 
-	data := make(map[string][]string)
-	for _, header := range headers {
-		data[header] = []string{}
+// printLists writes a table of the lists, sorted by label, with their type,
+// ID and number of entities.
+func printLists(w io.Writer, lists []feedly.FeedlyList) error {
+	sorted := make([]feedly.FeedlyList, len(lists))
+	copy(sorted, lists)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Label < sorted[j].Label })
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "LABEL\tTYPE\tID\tENTITIES")
+	for _, list := range sorted {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%d\n", list.Label, list.Type, list.ID, len(list.Entities))
 	}
+	return table.Flush()
+}
 
-	rowCount := 1
-	for {
-		record, err := reader.Read()
-		if err == io.EOF {
-			break
+// printDiff writes the diff of every column as an indented tree: the list
+// name, then the keywords that would be added (+), kept (=) and removed (-).
+func printDiff(w io.Writer, diffs []feedly.ListDiff) error {
+	out := bufio.NewWriter(w)
+	for _, diff := range diffs {
+		fmt.Fprintf(out, "%s (list %q): %d added, %d existing, %d removed\n", diff.Column, diff.List, len(diff.Added), len(diff.Existing), len(diff.Removed))
+		for _, text := range diff.Added {
+			fmt.Fprintf(out, "  + %s\n", text)
 		}
-		if err != nil {
-			return nil, fmt.Errorf("error reading CSV row: %v", err)
+		for _, text := range diff.Existing {
+			fmt.Fprintf(out, "  = %s\n", text)
 		}
-
-		rowCount++
-		if rowCount > 51 {
-			log.Printf("Warning: CSV has more than 51 rows (including header). Truncating excess rows.")
-			break
-		}
-
-		for i, value := range record {
-			if i < len(headers) && value != "" {
-				data[headers[i]] = append(data[headers[i]], value)
-			}
+		for _, text := range diff.Removed {
+			fmt.Fprintf(out, "  - %s\n", text)
 		}
 	}
-
-	return data, nil
+	return out.Flush()
 }
 
-func fetchFeedlyData(config Config) ([]FeedlyList, error) {
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s?details=true", config.UploadURL), nil)
-	if err != nil {
-		return nil, fmt.Errorf("error creating request: %v", err)
+// printChecks writes a table of the preflight findings, one column per row.
+func printChecks(w io.Writer, checks []feedly.ColumnCheck) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "COLUMN\tLIST\tSTATUS\tDETAIL")
+	for _, check := range checks {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", check.Column, check.List, check.Status, check.Detail)
 	}
+	return table.Flush()
+}
 
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", config.APIKey))
+// printListCounts writes a table of the entity count of every list before
+// and after the sync, with the entries that were cut off by max_rows.
+func printListCounts(w io.Writer, counts []feedly.ListCount) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "LIST\tCOLUMN\tBEFORE\tAFTER\tSKIPPED")
+	for _, count := range counts {
+		fmt.Fprintf(table, "%s\t%s\t%d\t%d\t%d\n", count.Label, count.Column, count.Before, count.After, count.Skipped)
+	}
+	return table.Flush()
+}
 
-	resp, err := client.Do(req)
+// confirmChanges asks for confirmation before a sync that would remove
+// keywords from lists (replace mode) or delete lists (prune_missing), after
+// printing how much would go. It returns an error if the answer is not yes,
+// or if stdin is not a terminal, as -yes is then required to go ahead.
+func confirmChanges(ctx context.Context, columns *feedly.ColumnIterator, feedlyData []feedly.FeedlyList, config feedly.Config) error {
+	removed, lists := 0, 0
+	csvData, err := columns.NextBatch(ctx, 0)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching Feedly data: %v", err)
+		return fmt.Errorf("failed to read CSV data: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	columns.Reset()
+	for _, diff := range feedly.ComputeDiff(csvData, feedlyData, config) {
+		if len(diff.Removed) > 0 {
+			removed += len(diff.Removed)
+			lists++
+		}
 	}
 
-	var feedlyData []FeedlyList
-	if err := json.NewDecoder(resp.Body).Decode(&feedlyData); err != nil {
-		return nil, fmt.Errorf("error decoding Feedly response: %v", err)
+	deletes := len(feedly.ListsToPrune(csvData, feedlyData, config))
+	if removed == 0 && deletes == 0 {
+		return nil
+	}
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return fmt.Errorf("%w: the sync would remove %d keywords from %d lists and delete %d lists; not running interactively, pass -yes to confirm", errNotConfirmed, removed, lists, deletes)
 	}
+	fmt.Fprintf(os.Stderr, "This sync will remove %d keywords from %d lists and delete %d lists in Feedly. Continue? [y/N] ", removed, lists, deletes)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if answer := strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+		return fmt.Errorf("%w, nothing was changed", errNotConfirmed)
+	}
+	return nil
+}
 
-	return feedlyData, nil
+// stringList is a flag.Value that collects every occurrence of a
+// repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
 }
 
-func syncToFeedly(csvData map[string][]string, feedlyData []FeedlyList, config Config) error {
-	client := &http.Client{}
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
 
-	for listName, entries := range csvData {
-		if len(entries) == 0 {
-			continue
+// splitColumns splits a comma separated -include or -exclude value into
+// column names with surrounding spaces trimmed, as the GUI does, so that
+// "Tech, Finance" names "Finance" and not " Finance". Empty names are
+// dropped.
+func splitColumns(value string) []string {
+	var columns []string
+	for _, column := range strings.Split(value, ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			columns = append(columns, column)
 		}
+	}
+	return columns
+}
 
-		var existingLists []FeedlyList
-		for _, list := range feedlyData {
-			if strings.HasPrefix(list.Label, listName) {
-				existingLists = append(existingLists, list)
-			}
-		}
+func exitOnAuthError(err error) {
+	var authErr *feedly.AuthError
+	if errors.As(err, &authErr) {
+		log.Printf("Authentication failed: %v", authErr)
+		os.Exit(exitCodeAuth)
+	}
+}
 
-		var entities []FeedlyEntity
-		for _, entry := range entries {
-			entities = append(entities, FeedlyEntity{
-				Type: "customKeyword",
-				Text: entry,
-			})
+// validateConfig implements -validate: it loads and validates the config at
+// path and, with connect, checks with one authenticated request that Feedly
+// can be reached with it. Every step is reported on w. The CSV files are not
+// read and nothing is changed in Feedly. It returns the exit status: 1 for
+// an invalid config, exitCodeAuth if Feedly rejects the credentials and
+// exitCodeFailed if Feedly cannot be reached.
+func validateConfig(ctx context.Context, w io.Writer, path, profile string, connect bool) int {
+	config, err := feedly.LoadProfile(path, profile)
+	if err != nil {
+		fmt.Fprintf(w, "config %s: %v\n", path, err)
+		return 1
+	}
+	fmt.Fprintf(w, "config %s: ok\n", path)
+	if !connect {
+		return 0
+	}
+
+	feedly.SetLogLevel(config.LogLevel)
+	config = feedly.WithRunID(config)
+	if err := feedly.TestConnection(ctx, feedly.NewHTTPClient(config), config); err != nil {
+		fmt.Fprintf(w, "connection to %s: %v\n", config.UploadURL, err)
+		if errors.Is(err, feedly.ErrAuthFailed) {
+			return exitCodeAuth
 		}
+		return exitCodeFailed
+	}
+	fmt.Fprintf(w, "connection to %s: ok\n", config.UploadURL)
+	return 0
+}
 
-		if len(existingLists) == 0 {
-			newList := FeedlyList{
-				Label:    listName,
-				Type:     "customTopic",
-				Entities: entities,
-			}
+// runInit implements the "init" subcommand, which writes a config template.
+func runInit(args []string) {
+	initFlags := flag.NewFlagSet("init", flag.ExitOnError)
+	configPath := initFlags.String("config", "config.json", "path of the config file to create")
+	force := initFlags.Bool("force", false, "overwrite an existing config file")
+	initFlags.Parse(args)
 
-			payload, err := json.Marshal(newList)
-			if err != nil {
-				return fmt.Errorf("error marshaling new list: %v", err)
-			}
+	if err := feedly.WriteConfigTemplate(*configPath, *force); err != nil {
+		log.Fatalf("Failed to create config: %v", err)
+	}
+	feedly.LogInfof("Wrote %s, fill in upload_url, api_key and csv_path before the first sync", *configPath)
+}
 
-			req, err := http.NewRequest("POST", config.UploadURL, strings.NewReader(string(payload)))
-			if err != nil {
-				return fmt.Errorf("error creating request: %v", err)
-			}
+// runOptions are the command line flags that change what runSync does.
+type runOptions struct {
+	showDiff   bool
+	check      bool
+	yes        bool
+	jsonOutput bool
+	summary    bool
+}
 
-			req.Header.Add("Content-Type", "application/json")
-			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", config.APIKey))
+// runSync reads the CSV files, fetches the Feedly lists and syncs them, or
+// prints the diff with -diff or the preflight findings with -check. It is
+// one run of the CLI; -watch calls it again for every change. The result is
+// empty unless the sync was started.
+func runSync(ctx context.Context, client *http.Client, config feedly.Config, opts runOptions) (feedly.SyncResult, error) {
+	// Columns are read and synced in batches to keep large files out of
+	// memory.
+	columns, err := feedly.NewColumnIterator(ctx, config.CSVFiles(), config)
+	if errors.Is(err, feedly.ErrNoDataRows) {
+		// An empty export is not a failure, so cron jobs exit cleanly.
+		feedly.LogWarnf("Warning: %v", err)
+		return feedly.SyncResult{}, nil
+	}
+	if err != nil {
+		return feedly.SyncResult{}, fmt.Errorf("failed to read CSV data: %w", err)
+	}
 
-			resp, err := client.Do(req)
-			if err != nil {
-				return fmt.Errorf("error creating list: %v", err)
+	feedlyData, err := feedly.FetchFeedlyData(ctx, client, config)
+	if err != nil {
+		return feedly.SyncResult{}, fmt.Errorf("failed to fetch Feedly data: %w", err)
+	}
+	if opts.showDiff || opts.check {
+		// Diffs and checks are read in one pass over the files.
+		csvData, err := columns.NextBatch(ctx, 0)
+		if err != nil {
+			return feedly.SyncResult{}, fmt.Errorf("failed to read CSV data: %w", err)
+		}
+		if opts.showDiff {
+			if err := printDiff(os.Stdout, feedly.ComputeDiff(csvData, feedlyData, config)); err != nil {
+				return feedly.SyncResult{}, fmt.Errorf("failed to print diff: %w", err)
 			}
-			resp.Body.Close()
-
-			if resp.StatusCode != http.StatusNoContent {
-				return fmt.Errorf("unexpected status code creating list: %d", resp.StatusCode)
+			return feedly.SyncResult{}, nil
+		}
+		checks := feedly.PreflightCheck(csvData, feedlyData, config)
+		failed := 0
+		for _, check := range checks {
+			if check.Failed() {
+				failed++
 			}
+		}
+		if err := printChecks(os.Stdout, checks); err != nil {
+			return feedly.SyncResult{}, fmt.Errorf("failed to print check: %w", err)
+		}
+		if failed > 0 {
+			return feedly.SyncResult{}, fmt.Errorf("check failed: Feedly would reject the lists of %d columns", failed)
+		}
+		return feedly.SyncResult{}, nil
+	}
 
-			time.Sleep(time.Second)
-		} else {
-			for _, list := range existingLists {
-				if len(list.Entities) >= 50 {
-					continue
-				}
-
-				list.Entities = entities[:min(50-len(list.Entities), len(entities))]
-				
-				payload, err := json.Marshal(list)
-				if err != nil {
-					return fmt.Errorf("error marshaling updated list: %v", err)
-				}
-
-				req, err := http.NewRequest("PUT", config.UploadURL, strings.NewReader(string(payload)))
-				if err != nil {
-					return fmt.Errorf("error creating request: %v", err)
-				}
-
-				req.Header.Add("Content-Type", "application/json")
-				req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", config.APIKey))
-
-				resp, err := client.Do(req)
-				if err != nil {
-					return fmt.Errorf("error updating list: %v", err)
-				}
-				resp.Body.Close()
-
-				if resp.StatusCode != http.StatusNoContent {
-					return fmt.Errorf("unexpected status code updating list: %d", resp.StatusCode)
-				}
-
-				time.Sleep(time.Second)
-			}
+	if !config.DryRun && !opts.yes && (config.SyncMode == "replace" || config.PruneMissing) {
+		if err := confirmChanges(ctx, columns, feedlyData, config); err != nil {
+			return feedly.SyncResult{}, err
 		}
 	}
 
-	return nil
+	progress := func(done, total int, label string) {
+		feedly.LogInfof("Processed list %q (%d of %d, %d%%)", label, done, total, done*100/total)
+	}
+	result, err := feedly.SyncColumns(ctx, client, columns, feedlyData, config, progress)
+	feedly.AppendReport(result, err, config)
+	feedly.WriteMetrics(result, err, config)
+	if opts.jsonOutput {
+		summary, marshalErr := json.MarshalIndent(result, "", "  ")
+		if marshalErr != nil {
+			return result, fmt.Errorf("failed to encode sync result: %w", marshalErr)
+		}
+		fmt.Println(string(summary))
+	} else if opts.summary {
+		if err := printListCounts(os.Stdout, result.Lists); err != nil {
+			feedly.LogErrorf("Failed to print summary: %v", err)
+		}
+	}
+	if err != nil {
+		return result, fmt.Errorf("failed to sync data to Feedly: %w", err)
+	}
+
+	if config.DryRun {
+		feedly.LogInfof("Dry run finished, no changes were sent to Feedly")
+		return result, nil
+	}
+	feedly.LogInfof("Successfully synced data to Feedly")
+	return result, nil
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
+// exitOnSyncError exits if runSync failed: with exitCodePartial if some
+// lists were synced before the error, unless fail_on_orphan failed the run,
+// with 1 if the changes were not confirmed and with exitCodeFailed
+// otherwise.
+func exitOnSyncError(result feedly.SyncResult, err error) {
+	if err == nil {
+		return
 	}
-	return b
+	exitOnAuthError(err)
+	if errors.Is(err, errNotConfirmed) {
+		log.Fatal(err)
+	}
+	log.Print(err)
+	if result.ListsCreated+result.ListsUpdated+result.ListsDeleted > 0 && !errors.Is(err, feedly.ErrOrphanColumns) {
+		os.Exit(exitCodePartial)
+	}
+	os.Exit(exitCodeFailed)
+}
+
+// notifyStop returns a context that stops a sync gracefully on the first
+// SIGINT or SIGTERM: the lists being sent are finished and the rest are
+// skipped, see feedly.WithStop. The returned channel is closed at that
+// point. A second signal exits at once with exitCodeFailed. release stops
+// handling the signals.
+func notifyStop() (ctx context.Context, stopped <-chan struct{}, release func()) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-signals:
+		case <-done:
+			return
+		}
+		feedly.LogWarnf("Stopping after the lists being sent, interrupt again to exit at once")
+		close(stop)
+		select {
+		case <-signals:
+			log.Print("Interrupted, exiting without waiting for the lists being sent")
+			os.Exit(exitCodeFailed)
+		case <-done:
+		}
+	}()
+	release = func() {
+		signal.Stop(signals)
+		close(done)
+	}
+	return feedly.WithStop(context.Background(), stop), stop, release
+}
+
+// withBudget limits one sync or restore to max_duration, if it is set,
+// after which it stops as on the first interrupt, see feedly.WithBudget.
+func withBudget(ctx context.Context, config feedly.Config) (context.Context, func()) {
+	if config.MaxDuration <= 0 {
+		return ctx, func() {}
+	}
+	return feedly.WithBudget(ctx, time.Duration(config.MaxDuration))
 }
 
 func main() {
-	config, err := loadConfig()
-	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+	feedly.Version = version
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		runInit(os.Args[2:])
+		return
 	}
 
-	csvData, err := readCSVData(config.CSVPath)
-	if err != nil {
-		log.Fatalf("Failed to read CSV data: %v", err)
+	configPath := flag.String("config", "", "path to the config file (default $FEEDLY_CONFIG or config.json)")
+	envFile := flag.String("env-file", "", "dotenv file to read environment variables such as FEEDLY_API_KEY from")
+	profile := flag.String("profile", "", "profile of the config to use (default the profile \"default\", if there is one)")
+	dryRun := flag.Bool("dry-run", false, "log the changes that would be made without sending them to Feedly")
+	verbose := flag.Bool("verbose", false, "log every request (same as log_level debug)")
+	quiet := flag.Bool("quiet", false, "only log errors (same as log_level error)")
+	jsonOutput := flag.Bool("json", false, "print a JSON summary of the sync to stdout")
+	summary := flag.Bool("summary", false, "print the entity count of every list before and after the sync")
+	listOnly := flag.Bool("list", false, "print the current Feedly lists and their entity counts instead of syncing")
+	showDiff := flag.Bool("diff", false, "print the keywords a sync would add, keep and remove per list instead of syncing")
+	check := flag.Bool("check", false, "check that every column has a list or can get one that Feedly accepts instead of syncing")
+	var csvPaths stringList
+	flag.Var(&csvPaths, "csv", "CSV file to sync, may be repeated (overrides csv_path and csv_paths)")
+	onlyNew := flag.Bool("only-new", false, "only create lists for columns that have none yet and never change existing lists (same as only_create)")
+	yes := flag.Bool("yes", false, "do not ask before removing keywords or deleting lists")
+	force := flag.Bool("force", false, "sync every column, even those the state file records as unchanged")
+	include := flag.String("include", "", "comma separated columns to sync (overrides include_columns)")
+	exclude := flag.String("exclude", "", "comma separated columns to skip (overrides exclude_columns)")
+	exportPath := flag.String("export", "", "write the current Feedly lists to this CSV file instead of syncing")
+	restorePath := flag.String("restore", "", "upload the lists of this backup file back to Feedly instead of syncing")
+	watchFiles := flag.Bool("watch", false, "keep running and sync again whenever a CSV file changes")
+	maxDuration := flag.Duration("max-duration", 0, "stop a sync gracefully after this long, e.g. 10m (overrides max_duration)")
+	validate := flag.Bool("validate", false, "check the config and exit without reading the CSV files or syncing")
+	connect := flag.Bool("connect", false, "with -validate, also check that Feedly accepts the config with one request")
+	showVersion := flag.Bool("version", false, "print the version and exit")
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Println("feedly_asset_uploader_cli", version)
+		return
+	}
+
+	if *envFile != "" {
+		if err := loadEnvFile(*envFile); err != nil {
+			log.Fatalf("Failed to load env file: %v", err)
+		}
+	}
+	if *configPath == "" {
+		*configPath = os.Getenv("FEEDLY_CONFIG")
+	}
+	if *configPath == "" {
+		*configPath = "config.json"
+	}
+	if *validate {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		status := validateConfig(ctx, os.Stdout, *configPath, *profile, *connect)
+		stop()
+		os.Exit(status)
 	}
 
-	feedlyData, err := fetchFeedlyData(config)
+	config, err := feedly.LoadProfile(*configPath, *profile)
 	if err != nil {
-		log.Fatalf("Failed to fetch Feedly data: %v", err)
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if *dryRun {
+		config.DryRun = true
+	}
+	config.Force = *force
+	if *maxDuration > 0 {
+		config.MaxDuration = feedly.Duration(*maxDuration)
+	}
+	if *onlyNew {
+		config.OnlyCreate = true
+	}
+	if len(csvPaths) > 0 {
+		config.CSVPath, config.CSVPaths = "", csvPaths
+	}
+	if *include != "" {
+		config.IncludeColumns = splitColumns(*include)
+	}
+	if *exclude != "" {
+		config.ExcludeColumns = splitColumns(*exclude)
+	}
+	if *verbose {
+		config.LogLevel = "debug"
+	} else if *quiet {
+		config.LogLevel = "error"
+	}
+	feedly.SetLogLevel(config.LogLevel)
+
+	client := feedly.NewHTTPClient(config)
+	if *listOnly || *exportPath != "" {
+		// Nothing is changed in Feedly, so an interrupt ends these at once.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		config := feedly.WithRunID(config)
+		if *exportPath != "" {
+			if err := ExportToCSV(ctx, client, config, *exportPath); err != nil {
+				exitOnAuthError(err)
+				log.Fatalf("Failed to export Feedly lists: %v", err)
+			}
+			return
+		}
+		feedlyData, err := feedly.FetchFeedlyData(ctx, client, config)
+		if err != nil {
+			exitOnAuthError(err)
+			log.Fatalf("Failed to fetch Feedly data: %v", err)
+		}
+		if err := printLists(os.Stdout, feedlyData); err != nil {
+			log.Fatalf("Failed to print Feedly lists: %v", err)
+		}
+		return
+	}
+
+	ctx, stopped, release := notifyStop()
+	defer release()
+	if *restorePath != "" {
+		ctx, cancel := withBudget(ctx, config)
+		result, err := feedly.RestoreBackup(ctx, client, *restorePath, feedly.WithRunID(config))
+		cancel()
+		if err != nil {
+			err = fmt.Errorf("failed to restore backup: %w", err)
+		}
+		exitOnSyncError(result, err)
+		if config.DryRun {
+			feedly.LogInfof("Dry run finished, no changes were sent to Feedly")
+			return
+		}
+		feedly.LogInfof("Restored %d lists from %s", result.ListsCreated+result.ListsUpdated, *restorePath)
+		return
 	}
 
-	if err := syncToFeedly(csvData, feedlyData, config); err != nil {
-		log.Fatalf("Failed to sync data to Feedly: %v", err)
+	if err := config.ValidateCSVPath(); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	opts := runOptions{showDiff: *showDiff, check: *check, yes: *yes, jsonOutput: *jsonOutput, summary: *summary}
+	if !*watchFiles {
+		ctx, cancel := withBudget(ctx, config)
+		result, err := runSync(ctx, client, feedly.WithRunID(config), opts)
+		cancel()
+		exitOnSyncError(result, err)
+		return
 	}
 
-	log.Println("Successfully synced data to Feedly")
+	// In watch mode a failed run is logged and the next change tried
+	// again; only a rejected API key ends the program. Every run gets its
+	// own run ID unless one is configured, and its own max_duration.
+	sync := func() {
+		feedly.LogInfof("Starting sync")
+		ctx, cancel := withBudget(ctx, config)
+		defer cancel()
+		if _, err := runSync(ctx, client, feedly.WithRunID(config), opts); err != nil {
+			exitOnAuthError(err)
+			feedly.LogErrorf("Sync failed: %v", err)
+			return
+		}
+		feedly.LogInfof("Sync finished, waiting for the CSV files to change")
+	}
+	sync()
+	// After an interrupt the sync that is running finishes its lists and
+	// no further sync is started.
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-stopped:
+			cancel()
+		case <-watchCtx.Done():
+		}
+	}()
+	if err := watch(watchCtx, config.CSVFiles(), sync); err != nil {
+		log.Fatalf("Failed to watch CSV files: %v", err)
+	}
 }
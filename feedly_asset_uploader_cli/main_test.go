@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSplitColumns(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"Tech", "[Tech]"},
+		{"Tech,Finance", "[Tech Finance]"},
+		{"Tech, Finance ,  Health", "[Tech Finance Health]"},
+		{"Tech,,Finance,", "[Tech Finance]"},
+		{" , ", "[]"},
+	}
+	for _, test := range tests {
+		if got := fmt.Sprint(splitColumns(test.value)); got != test.want {
+			t.Errorf("splitColumns(%q) = %s, want %s", test.value, got, test.want)
+		}
+	}
+}
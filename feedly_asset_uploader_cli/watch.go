@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Palaract/feedly_asset_sync/internal/feedly"
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long the CSV files must stay unchanged after a write
+// before a sync starts, so that saving a file, which often takes several
+// writes, triggers a single sync.
+const watchDebounce = 500 * time.Millisecond
+
+// watch calls run whenever the modification time of one of the files
+// changes, until ctx is cancelled. The directories of the files are
+// watched rather than the files themselves, as many editors save by
+// replacing the file.
+func watch(ctx context.Context, files []string, run func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	modTimes := make(map[string]time.Time)
+	for _, file := range files {
+		file = filepath.Clean(file)
+		modTimes[file] = modTime(file)
+		if err := watcher.Add(filepath.Dir(file)); err != nil {
+			return fmt.Errorf("error watching %s: %v", file, err)
+		}
+	}
+	feedly.LogInfof("Watching %d CSV files for changes", len(files))
+
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if _, watched := modTimes[filepath.Clean(event.Name)]; watched && event.Has(fsnotify.Write|fsnotify.Create) {
+				debounce.Reset(watchDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			feedly.LogWarnf("Error watching the CSV files: %v", err)
+		case <-debounce.C:
+			changed := false
+			for file, last := range modTimes {
+				if current := modTime(file); !current.Equal(last) {
+					modTimes[file] = current
+					changed = true
+				}
+			}
+			if changed {
+				run()
+			}
+		}
+	}
+}
+
+// modTime returns the modification time of file, or the zero time if it
+// cannot be read, e.g. because it is being replaced.
+func modTime(file string) time.Time {
+	info, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
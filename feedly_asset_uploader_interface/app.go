@@ -2,17 +2,44 @@ package main
 
 import (
     "context"
-    "encoding/csv"
     "encoding/json"
+    "errors"
     "fmt"
-    "io"
-    "log"
     "os"
+    "sort"
     "strings"
+    "sync"
+    "time"
+
+    "github.com/Palaract/feedly_asset_sync/internal/feedly"
+    "github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
+// previewEntries is the number of entries PreviewCSVFiles shows per column.
+const previewEntries = 5
+
+// ColumnPreview is one column of a parsed CSV file: its header, its first
+// entries and the number of entries a sync would upload.
+type ColumnPreview struct {
+    Column  string   `json:"column"`
+    Entries []string `json:"entries"`
+    Total   int      `json:"total"`
+}
+
+// configPath is the config file the GUI reads and writes.
+const configPath = "config.json"
+
 type App struct {
-    ctx context.Context
+    ctx    context.Context
+    cancel context.CancelFunc
+
+    // mu guards config, the loaded and validated config file, which is
+    // read on first use and replaced by UpdateConfig and ReloadConfig, and
+    // profile, the profile of the file set by SelectProfile. An empty
+    // profile selects the default one, as in the CLI.
+    mu      sync.Mutex
+    config  *feedly.Config
+    profile string
 }
 
 func NewApp() *App {
@@ -20,91 +47,380 @@ func NewApp() *App {
 }
 
 func (a *App) startup(ctx context.Context) {
-    a.ctx = ctx
+    a.ctx, a.cancel = context.WithCancel(ctx)
 }
 
-func (a *App) GetConfig() (Config, error) {
-    return a.loadConfig()
+// shutdown cancels a sync that is still running when the window is closed.
+func (a *App) shutdown(ctx context.Context) {
+    a.cancel()
 }
 
-func (a *App) UpdateConfig(config Config) error {
-    file, err := os.Create("config.json")
+func (a *App) GetConfig() (feedly.Config, error) {
+    if _, err := os.Stat(configPath); os.IsNotExist(err) {
+        return feedly.DefaultConfig(), nil
+    }
+    return feedly.ReadConfig(configPath)
+}
+
+// InitConfig writes a config.json with every supported field set to its
+// default. An existing file is only replaced if force is set.
+func (a *App) InitConfig(force bool) error {
+    if err := feedly.WriteConfigTemplate(configPath, force); err != nil {
+        return err
+    }
+    a.mu.Lock()
+    a.config, a.profile = nil, ""
+    a.mu.Unlock()
+    return nil
+}
+
+// loadConfig returns the cached config, loading and validating config.json
+// with the selected profile first if it has not been loaded yet or failed to
+// load last time.
+func (a *App) loadConfig() (feedly.Config, error) {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    if a.config != nil {
+        return *a.config, nil
+    }
+    config, err := feedly.LoadProfile(configPath, a.profile)
     if err != nil {
-        return fmt.Errorf("error creating config file: %v", err)
+        return config, err
     }
-    defer file.Close()
+    a.config = &config
+    return config, nil
+}
+
+// ReloadConfig reads config.json again, so that changes made to the file
+// outside the GUI take effect without a restart. If the file is invalid the
+// error is returned and the next sync reports it as well.
+func (a *App) ReloadConfig() error {
+    a.mu.Lock()
+    a.config = nil
+    a.mu.Unlock()
+    if _, err := a.loadConfig(); err != nil {
+        return fmt.Errorf("error loading config: %w", err)
+    }
+    return nil
+}
 
+// ListProfiles returns the names of the profiles in config.json, sorted, so
+// that the frontend can offer them for SelectProfile. A file without
+// profiles is an error.
+func (a *App) ListProfiles() ([]string, error) {
+    config, err := feedly.ReadConfig(configPath)
+    if err != nil {
+        return nil, err
+    }
+    names := feedly.ProfileNames(config)
+    if len(names) == 0 {
+        return nil, fmt.Errorf("%s has no profiles", configPath)
+    }
+    return names, nil
+}
+
+// SelectProfile loads config.json with the named profile, which every
+// following sync, preview and export then uses. The selection is kept
+// if the profile is unknown or its config is invalid.
+func (a *App) SelectProfile(name string) error {
+    config, err := feedly.LoadProfile(configPath, name)
+    if err != nil {
+        return fmt.Errorf("error selecting profile %q: %w", name, err)
+    }
+    a.mu.Lock()
+    a.config, a.profile = &config, name
+    a.mu.Unlock()
+    return nil
+}
+
+func (a *App) UpdateConfig(config feedly.Config) error {
+    // The config is checked with the selected profile, as it will be
+    // loaded; "${ENV:...}" references and api_key_file are written back to
+    // the file unchanged.
+    a.mu.Lock()
+    profile := a.profile
+    a.mu.Unlock()
+    if _, err := feedly.ApplyProfile(config, profile); err != nil {
+        return err
+    }
+
+    file, err := os.Create(configPath)
+    if err != nil {
+        return fmt.Errorf("error creating config file: %v", err)
+    }
     encoder := json.NewEncoder(file)
     encoder.SetIndent("", "    ")
     if err := encoder.Encode(config); err != nil {
+        file.Close()
         return fmt.Errorf("error encoding config: %v", err)
     }
+    if err := file.Close(); err != nil {
+        return fmt.Errorf("error writing config file: %v", err)
+    }
 
-    return nil
+    // The saved config is used from the next sync on.
+    return a.ReloadConfig()
 }
 
 func (a *App) ProcessCSVData(csvContent string) (string, error) {
+    return a.ProcessCSVFiles([]string{csvContent})
+}
+
+// ProcessCSVFiles merges the contents of several CSV files, as
+// feedly.ReadCSVData does for the CLI, and syncs the result.
+func (a *App) ProcessCSVFiles(csvContents []string) (string, error) {
     config, err := a.loadConfig()
     if err != nil {
-        return "", fmt.Errorf("error loading config: %v", err)
+        return "", fmt.Errorf("error loading config: %w", err)
     }
+    feedly.SetLogLevel(config.LogLevel)
+    config = feedly.WithRunID(config)
 
-    if len(csvContent) == 0 {
-        return "", fmt.Errorf("empty CSV content")
+    data, warnings, dropped, capped, err := a.parseCSVFiles(csvContents, config)
+    if errors.Is(err, feedly.ErrNoDataRows) {
+        // Nothing to sync is reported as a warning rather than an error.
+        summary, err := json.Marshal(feedly.SyncResult{
+            Errors:   []feedly.ListError{},
+            Warnings: []string{"No data rows found, nothing to sync."},
+            Columns:  []feedly.ColumnCount{},
+        })
+        if err != nil {
+            return "", fmt.Errorf("error encoding sync result: %v", err)
+        }
+        return string(summary), nil
+    }
+    if err != nil {
+        return "", err
     }
 
-    reader := csv.NewReader(strings.NewReader(csvContent))
-    
-    headers, err := reader.Read()
+    client := feedly.NewHTTPClient(config)
+    feedlyData, err := feedly.FetchFeedlyData(a.ctx, client, config)
     if err != nil {
-        return "", fmt.Errorf("error reading CSV headers: %v", err)
+        return "", fmt.Errorf("error fetching Feedly data: %w", err)
     }
 
-    if len(headers) == 0 {
-        return "", fmt.Errorf("no headers found in CSV")
+    progress := func(done, total int, label string) {
+        runtime.EventsEmit(a.ctx, "sync:progress", map[string]interface{}{
+            "done":  done,
+            "total": total,
+            "label": label,
+        })
+    }
+    // Failed lists are reported through the result so the user can see
+    // which lists made it to Feedly and which did not, and so is a sync
+    // that ran out of max_duration.
+    ctx := a.ctx
+    if config.MaxDuration > 0 {
+        var cancel func()
+        ctx, cancel = feedly.WithBudget(ctx, time.Duration(config.MaxDuration))
+        defer cancel()
+    }
+    result, err := feedly.SyncToFeedly(ctx, client, data, feedlyData, config, progress)
+    result.Warnings = warnings
+    result.KeywordsDropped = dropped
+    result.CapColumns(capped)
+    feedly.AppendReport(result, err, config)
+    feedly.WriteMetrics(result, err, config)
+    if err != nil && len(result.Errors) == 0 && !result.BudgetExceeded {
+        return "", fmt.Errorf("error syncing to Feedly: %w", err)
     }
 
-    data := make(map[string][]string)
-    for _, header := range headers {
-        data[header] = []string{}
+    summary, err := json.Marshal(result)
+    if err != nil {
+        return "", fmt.Errorf("error encoding sync result: %v", err)
     }
+    return string(summary), nil
+}
 
-    rowCount := 1
-    for {
-        record, err := reader.Read()
-        if err == io.EOF {
-            break
-        }
-        if err != nil {
-            return "", fmt.Errorf("error reading CSV row: %v", err)
-        }
+// PreviewDiff compares the CSV files with the current Feedly lists and
+// returns the keywords a sync would add, keep and remove per list as JSON,
+// without changing anything in Feedly.
+func (a *App) PreviewDiff(csvContents []string) (string, error) {
+    config, err := a.loadConfig()
+    if err != nil {
+        return "", fmt.Errorf("error loading config: %w", err)
+    }
+    feedly.SetLogLevel(config.LogLevel)
+    config = feedly.WithRunID(config)
 
-        rowCount++
-        if rowCount > 51 {
-            log.Printf("Warning: CSV has more than 51 rows (including header). Truncating excess rows.")
-            break
+    data, _, _, _, err := a.parseCSVFiles(csvContents, config)
+    if err != nil {
+        return "", err
+    }
+
+    feedlyData, err := feedly.FetchFeedlyData(a.ctx, feedly.NewHTTPClient(config), config)
+    if err != nil {
+        return "", fmt.Errorf("error fetching Feedly data: %w", err)
+    }
+
+    diff, err := json.Marshal(feedly.ComputeDiff(data, feedlyData, config))
+    if err != nil {
+        return "", fmt.Errorf("error encoding diff: %v", err)
+    }
+    return string(diff), nil
+}
+
+func (a *App) PreviewCSV(csvContent string) (string, error) {
+    return a.PreviewCSVFiles([]string{csvContent})
+}
+
+// PreviewCSVFiles parses the CSV files as ProcessCSVFiles does and returns
+// the columns, sorted by header, with their first entries as JSON, so that
+// the delimiter and headers can be checked before syncing. Nothing is sent
+// to Feedly.
+func (a *App) PreviewCSVFiles(csvContents []string) (string, error) {
+    config, err := a.loadConfig()
+    if err != nil {
+        return "", fmt.Errorf("error loading config: %w", err)
+    }
+    feedly.SetLogLevel(config.LogLevel)
+
+    data, _, _, _, err := a.parseCSVFiles(csvContents, config)
+    if err != nil {
+        return "", err
+    }
+
+    previews := make([]ColumnPreview, 0, len(data))
+    for header, entries := range data {
+        preview := ColumnPreview{Column: header, Entries: entries, Total: len(entries)}
+        if len(entries) > previewEntries {
+            preview.Entries = entries[:previewEntries]
         }
+        previews = append(previews, preview)
+    }
+    sort.Slice(previews, func(i, j int) bool { return previews[i].Column < previews[j].Column })
+
+    preview, err := json.Marshal(previews)
+    if err != nil {
+        return "", fmt.Errorf("error encoding preview: %v", err)
+    }
+    return string(preview), nil
+}
+
+// PreflightCheck compares the CSV files with the current Feedly lists and
+// returns, as JSON, whether each column has a list or can get one that
+// Feedly accepts, without changing anything in Feedly.
+func (a *App) PreflightCheck(csvContents []string) (string, error) {
+    config, err := a.loadConfig()
+    if err != nil {
+        return "", fmt.Errorf("error loading config: %w", err)
+    }
+    feedly.SetLogLevel(config.LogLevel)
+    config = feedly.WithRunID(config)
+
+    data, _, _, _, err := a.parseCSVFiles(csvContents, config)
+    if err != nil {
+        return "", err
+    }
+
+    feedlyData, err := feedly.FetchFeedlyData(a.ctx, feedly.NewHTTPClient(config), config)
+    if err != nil {
+        return "", fmt.Errorf("error fetching Feedly data: %w", err)
+    }
+
+    checks, err := json.Marshal(feedly.PreflightCheck(data, feedlyData, config))
+    if err != nil {
+        return "", fmt.Errorf("error encoding check: %v", err)
+    }
+    return string(checks), nil
+}
 
-        for i, value := range record {
-            if i < len(headers) && value != "" {
-                data[headers[i]] = append(data[headers[i]], value)
+// parseCSVFiles parses and merges the contents of the CSV files and prepares
+// the columns for syncing, like feedly.ReadCSVData. It returns the column
+// warnings, the number of dropped over-long keywords and the entries cut
+// off by max_rows per column as well, and feedly.ErrNoDataRows if no file
+// has any data rows.
+func (a *App) parseCSVFiles(csvContents []string, config feedly.Config) (map[string][]string, []string, int, map[string]int, error) {
+    // The frontend already decoded the files from config.Encoding.
+    config.Encoding = "utf-8"
+    data := make(map[string][]string)
+    withRows := 0
+    for i, csvContent := range csvContents {
+        columns, err := feedly.ParseInput(a.ctx, strings.NewReader(csvContent), config)
+        if errors.Is(err, feedly.ErrNoDataRows) {
+            feedly.LogWarnf("Warning: file %d has no data rows", i+1)
+            feedly.MergeColumns(data, columns)
+            continue
+        }
+        if err != nil {
+            if a.ctx.Err() != nil {
+                return nil, nil, 0, nil, a.ctx.Err()
             }
+            return nil, nil, 0, nil, fmt.Errorf("file %d: %w", i+1, err)
         }
+        feedly.MergeColumns(data, columns)
+        withRows++
     }
+    if withRows == 0 {
+        return nil, nil, 0, nil, feedly.ErrNoDataRows
+    }
+
+    warnings, dropped, capped := feedly.PrepareColumns(data, config)
 
     if len(data) == 0 {
-        return "", fmt.Errorf("no valid data found in CSV")
+        return nil, nil, 0, nil, fmt.Errorf("%w: no valid data found in CSV", feedly.ErrInvalidCSV)
     }
+    return data, warnings, dropped, capped, nil
+}
 
-    feedlyData, err := a.fetchFeedlyData(config)
+// TestConnection checks the saved URL and API key with a single-item,
+// authenticated GET of the Feedly lists. It is not retried so that a bad
+// config is reported right away.
+func (a *App) TestConnection() (string, error) {
+    config, err := a.loadConfig()
     if err != nil {
-        return "", fmt.Errorf("error fetching Feedly data: %v", err)
+        return "", fmt.Errorf("error loading config: %w", err)
     }
+    config = feedly.WithRunID(config)
+
+    err = feedly.TestConnection(a.ctx, feedly.NewHTTPClient(config), config)
+    switch {
+    case errors.Is(err, feedly.ErrAuthFailed):
+        return "", fmt.Errorf("authentication failed: %w", err)
+    case errors.Is(err, feedly.ErrRateLimited):
+        return "", fmt.Errorf("Feedly is rate limiting requests, try again later: %w", err)
+    case err != nil:
+        return "", fmt.Errorf("could not reach Feedly at %s: %w", config.UploadURL, err)
+    }
+    return fmt.Sprintf("Connected to Feedly at %s", config.UploadURL), nil
+}
 
-    err = a.syncToFeedly(data, feedlyData, config)
+// ExportToCSV asks for a file name and writes the current Feedly lists to it
+// in the CSV format ProcessCSVData consumes. It returns the chosen path, or
+// an empty string if the dialog was cancelled.
+func (a *App) ExportToCSV() (string, error) {
+    config, err := a.loadConfig()
+    if err != nil {
+        return "", fmt.Errorf("error loading config: %w", err)
+    }
+    feedly.SetLogLevel(config.LogLevel)
+    config = feedly.WithRunID(config)
+
+    path, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+        Title:           "Export Feedly lists",
+        DefaultFilename: "feedly_lists.csv",
+        Filters:         []runtime.FileFilter{{DisplayName: "CSV files (*.csv)", Pattern: "*.csv"}},
+    })
+    if err != nil {
+        return "", fmt.Errorf("error choosing export file: %v", err)
+    }
+    if path == "" {
+        return "", nil
+    }
+
+    feedlyData, err := feedly.FetchFeedlyData(a.ctx, feedly.NewHTTPClient(config), config)
     if err != nil {
-        return "", fmt.Errorf("error syncing to Feedly: %v", err)
+        return "", fmt.Errorf("error fetching Feedly data: %w", err)
     }
 
-    return "Sync completed successfully", nil
-}
\ No newline at end of file
+    file, err := os.Create(path)
+    if err != nil {
+        return "", fmt.Errorf("error creating export file: %v", err)
+    }
+    defer file.Close()
+
+    if err := feedly.WriteListsCSV(file, feedlyData, config); err != nil {
+        return "", err
+    }
+    return path, nil
+}
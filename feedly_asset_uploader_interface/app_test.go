@@ -0,0 +1,48 @@
+package main
+
+import (
+    "os"
+    "testing"
+
+    "github.com/Palaract/feedly_asset_sync/internal/feedly"
+)
+
+// inTempDir runs the test in an empty directory, where config.json is
+// read and written.
+func inTempDir(t *testing.T) {
+    dir, err := os.Getwd()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := os.Chdir(t.TempDir()); err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { os.Chdir(dir) })
+}
+
+func TestUpdateConfigProfileOnly(t *testing.T) {
+    inTempDir(t)
+    t.Setenv("FEEDLY_API_KEY", "")
+    t.Setenv("FEEDLY_UPLOAD_URL", "")
+    config := feedly.DefaultConfig()
+    config.Profiles = map[string]feedly.Profile{
+        "default": {UploadURL: "https://feedly.example/lists", APIKey: "key"},
+    }
+
+    app := NewApp()
+    if err := app.UpdateConfig(config); err != nil {
+        t.Fatalf("UpdateConfig of a config with only a default profile: %v", err)
+    }
+    loaded, err := app.loadConfig()
+    if err != nil {
+        t.Fatalf("loadConfig: %v", err)
+    }
+    if loaded.UploadURL != "https://feedly.example/lists" || loaded.APIKey != "key" {
+        t.Errorf("loaded %s, %s, want the default profile", loaded.UploadURL, loaded.APIKey)
+    }
+
+    config.Profiles = nil
+    if err := app.UpdateConfig(config); err == nil {
+        t.Error("UpdateConfig without an account = nil, want an error")
+    }
+}
@@ -1,9 +1,31 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
-import {main} from '../models';
+import {feedly} from '../models';
 
-export function GetConfig():Promise<main.Config>;
+export function ExportToCSV():Promise<string>;
+
+export function GetConfig():Promise<feedly.Config>;
+
+export function InitConfig(arg1:boolean):Promise<void>;
+
+export function ListProfiles():Promise<Array<string>>;
+
+export function PreflightCheck(arg1:Array<string>):Promise<string>;
+
+export function PreviewCSV(arg1:string):Promise<string>;
+
+export function PreviewCSVFiles(arg1:Array<string>):Promise<string>;
+
+export function PreviewDiff(arg1:Array<string>):Promise<string>;
 
 export function ProcessCSVData(arg1:string):Promise<string>;
 
-export function UpdateConfig(arg1:main.Config):Promise<void>;
+export function ProcessCSVFiles(arg1:Array<string>):Promise<string>;
+
+export function ReloadConfig():Promise<void>;
+
+export function SelectProfile(arg1:string):Promise<void>;
+
+export function TestConnection():Promise<string>;
+
+export function UpdateConfig(arg1:feedly.Config):Promise<void>;
@@ -2,14 +2,58 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function ExportToCSV() {
+  return window['go']['main']['App']['ExportToCSV']();
+}
+
 export function GetConfig() {
   return window['go']['main']['App']['GetConfig']();
 }
 
+export function InitConfig(arg1) {
+  return window['go']['main']['App']['InitConfig'](arg1);
+}
+
+export function ListProfiles() {
+  return window['go']['main']['App']['ListProfiles']();
+}
+
+export function PreflightCheck(arg1) {
+  return window['go']['main']['App']['PreflightCheck'](arg1);
+}
+
+export function PreviewCSV(arg1) {
+  return window['go']['main']['App']['PreviewCSV'](arg1);
+}
+
+export function PreviewCSVFiles(arg1) {
+  return window['go']['main']['App']['PreviewCSVFiles'](arg1);
+}
+
+export function PreviewDiff(arg1) {
+  return window['go']['main']['App']['PreviewDiff'](arg1);
+}
+
 export function ProcessCSVData(arg1) {
   return window['go']['main']['App']['ProcessCSVData'](arg1);
 }
 
+export function ProcessCSVFiles(arg1) {
+  return window['go']['main']['App']['ProcessCSVFiles'](arg1);
+}
+
+export function ReloadConfig() {
+  return window['go']['main']['App']['ReloadConfig']();
+}
+
+export function SelectProfile(arg1) {
+  return window['go']['main']['App']['SelectProfile'](arg1);
+}
+
+export function TestConnection() {
+  return window['go']['main']['App']['TestConnection']();
+}
+
 export function UpdateConfig(arg1) {
   return window['go']['main']['App']['UpdateConfig'](arg1);
 }
@@ -1,8 +1,86 @@
-export namespace main {
+export namespace feedly {
 	
+	export class Profile {
+	    upload_url: string;
+	    api_key: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new Profile(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.upload_url = source["upload_url"];
+	        this.api_key = source["api_key"];
+	    }
+	}
 	export class Config {
 	    upload_url: string;
 	    api_key: string;
+	    api_key_file: string;
+	    auth_scheme: string;
+	    auth_header: string;
+	    username: string;
+	    password: string;
+	    csv_path: string;
+	    csv_paths: string[];
+	    max_retries: number;
+	    conflict_retries: number;
+	    retry_base_delay: number;
+	    max_rows: number;
+	    max_entities_per_list: number;
+	    max_payload_bytes: number;
+	    max_lists_per_run: number;
+	    shared_keyword_limit: number;
+	    max_keyword_length: number;
+	    on_overlong_keyword: string;
+	    dry_run: boolean;
+	    prefix_match: boolean;
+	    overflow_label_format: string;
+	    timeout: number;
+	    request_timeout: number;
+	    max_duration: number;
+	    delimiter: string;
+	    encoding: string;
+	    input_format: string;
+	    case_sensitive_dedup: boolean;
+	    sync_mode: string;
+	    log_level: string;
+	    concurrency: number;
+	    requests_per_second: number;
+	    page_size: number;
+	    fetch_query: {[key: string]: string};
+	    normalize_keywords: boolean;
+	    lowercase_keywords: boolean;
+	    user_agent: string;
+	    strict_columns: boolean;
+	    include_columns: string[];
+	    exclude_columns: string[];
+	    column_glob: boolean;
+	    state_file: string;
+	    label_mapping: {[key: string]: string};
+	    label_prefix: string;
+	    label_suffix: string;
+	    list_ids: {[key: string]: string};
+	    list_types: {[key: string]: string};
+	    default_entity_type: string;
+	    entity_types: {[key: string]: string};
+	    report_path: string;
+	    backup_dir: string;
+	    metrics_path: string;
+	    prune_missing: boolean;
+	    prune_pattern: string;
+	    cell_split_char: string;
+	    weight_separator: string;
+	    proxy_url: string;
+	    ca_cert_file: string;
+	    insecure_skip_verify: boolean;
+	    extra_headers: {[key: string]: string};
+	    run_id: string;
+	    only_create: boolean;
+	    refetch_after_create: boolean;
+	    fail_on_orphan: boolean;
+	    profiles: {[key: string]: Profile};
 	
 	    static createFrom(source: any = {}) {
 	        return new Config(source);
@@ -12,7 +90,89 @@ export namespace main {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.upload_url = source["upload_url"];
 	        this.api_key = source["api_key"];
+	        this.api_key_file = source["api_key_file"];
+	        this.auth_scheme = source["auth_scheme"];
+	        this.auth_header = source["auth_header"];
+	        this.username = source["username"];
+	        this.password = source["password"];
+	        this.csv_path = source["csv_path"];
+	        this.csv_paths = source["csv_paths"];
+	        this.max_retries = source["max_retries"];
+	        this.conflict_retries = source["conflict_retries"];
+	        this.retry_base_delay = source["retry_base_delay"];
+	        this.max_rows = source["max_rows"];
+	        this.max_entities_per_list = source["max_entities_per_list"];
+	        this.max_payload_bytes = source["max_payload_bytes"];
+	        this.max_lists_per_run = source["max_lists_per_run"];
+	        this.shared_keyword_limit = source["shared_keyword_limit"];
+	        this.max_keyword_length = source["max_keyword_length"];
+	        this.on_overlong_keyword = source["on_overlong_keyword"];
+	        this.dry_run = source["dry_run"];
+	        this.prefix_match = source["prefix_match"];
+	        this.overflow_label_format = source["overflow_label_format"];
+	        this.timeout = source["timeout"];
+	        this.request_timeout = source["request_timeout"];
+	        this.max_duration = source["max_duration"];
+	        this.delimiter = source["delimiter"];
+	        this.encoding = source["encoding"];
+	        this.input_format = source["input_format"];
+	        this.case_sensitive_dedup = source["case_sensitive_dedup"];
+	        this.sync_mode = source["sync_mode"];
+	        this.log_level = source["log_level"];
+	        this.concurrency = source["concurrency"];
+	        this.requests_per_second = source["requests_per_second"];
+	        this.page_size = source["page_size"];
+	        this.fetch_query = source["fetch_query"];
+	        this.normalize_keywords = source["normalize_keywords"];
+	        this.lowercase_keywords = source["lowercase_keywords"];
+	        this.user_agent = source["user_agent"];
+	        this.strict_columns = source["strict_columns"];
+	        this.include_columns = source["include_columns"];
+	        this.exclude_columns = source["exclude_columns"];
+	        this.column_glob = source["column_glob"];
+	        this.state_file = source["state_file"];
+	        this.label_mapping = source["label_mapping"];
+	        this.label_prefix = source["label_prefix"];
+	        this.label_suffix = source["label_suffix"];
+	        this.list_ids = source["list_ids"];
+	        this.list_types = source["list_types"];
+	        this.default_entity_type = source["default_entity_type"];
+	        this.entity_types = source["entity_types"];
+	        this.report_path = source["report_path"];
+	        this.backup_dir = source["backup_dir"];
+	        this.metrics_path = source["metrics_path"];
+	        this.prune_missing = source["prune_missing"];
+	        this.prune_pattern = source["prune_pattern"];
+	        this.cell_split_char = source["cell_split_char"];
+	        this.weight_separator = source["weight_separator"];
+	        this.proxy_url = source["proxy_url"];
+	        this.ca_cert_file = source["ca_cert_file"];
+	        this.insecure_skip_verify = source["insecure_skip_verify"];
+	        this.extra_headers = source["extra_headers"];
+	        this.run_id = source["run_id"];
+	        this.only_create = source["only_create"];
+	        this.refetch_after_create = source["refetch_after_create"];
+	        this.fail_on_orphan = source["fail_on_orphan"];
+	        this.profiles = this.convertValues(source["profiles"], Profile, true);
 	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
 
 }
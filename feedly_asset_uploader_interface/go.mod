@@ -1,10 +1,13 @@
-module feedly_asset_sync
+module github.com/Palaract/feedly_asset_sync/feedly_asset_uploader_interface
 
 go 1.21
 
 toolchain go1.23.4
 
-require github.com/wailsapp/wails/v2 v2.9.2
+require (
+	github.com/Palaract/feedly_asset_sync v0.0.0
+	github.com/wailsapp/wails/v2 v2.9.2
+)
 
 require (
 	github.com/bep/debounce v1.2.1 // indirect
@@ -34,6 +37,10 @@ require (
 	golang.org/x/net v0.25.0 // indirect
 	golang.org/x/sys v0.20.0 // indirect
 	golang.org/x/text v0.15.0 // indirect
+	golang.org/x/time v0.5.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
+replace github.com/Palaract/feedly_asset_sync => ../
+
 // replace github.com/wailsapp/wails/v2 v2.9.2 => C:\Users\willy.mroczowski\go\pkg\mod
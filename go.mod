@@ -0,0 +1,9 @@
+module github.com/Palaract/feedly_asset_sync
+
+go 1.21
+
+require (
+	golang.org/x/text v0.15.0
+	golang.org/x/time v0.5.0
+	gopkg.in/yaml.v3 v3.0.1
+)
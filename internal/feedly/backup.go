@@ -0,0 +1,137 @@
+package feedly
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// listBackup is the content of a backup file written to BackupDir.
+type listBackup struct {
+	Time  time.Time    `json:"time"`
+	RunID string       `json:"run_id,omitempty"`
+	Lists []FeedlyList `json:"lists"`
+}
+
+// backupLists writes the Feedly lists that a sync of the columns in csvData
+// may change or delete to a timestamped JSON file in BackupDir, if it is
+// set, so that they can be restored by hand. Only the headers of csvData
+// are used. Unlike the report, a failed backup is returned, as the sync
+// must not change any list that was not backed up. Dry runs write nothing.
+func backupLists(csvData map[string][]string, feedlyData []FeedlyList, config Config) error {
+	if config.BackupDir == "" || config.DryRun {
+		return nil
+	}
+
+	pruned := make(map[string]bool)
+	for _, list := range ListsToPrune(csvData, feedlyData, config) {
+		pruned[list.ID] = true
+	}
+	backup := listBackup{Time: time.Now(), RunID: config.RunID, Lists: []FeedlyList{}}
+	for _, list := range feedlyData {
+		if belongsToColumn(list, csvData, config) || pruned[list.ID] {
+			backup.Lists = append(backup.Lists, list)
+		}
+	}
+	if len(backup.Lists) == 0 {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding backup: %v", err)
+	}
+	if err := os.MkdirAll(config.BackupDir, 0o755); err != nil {
+		return fmt.Errorf("error creating backup directory: %v", err)
+	}
+	name := "feedly-lists-" + backup.Time.Format("20060102-150405")
+	if config.RunID != "" {
+		name += "-" + config.RunID
+	}
+	path := filepath.Join(config.BackupDir, name+".json")
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("error writing backup: %v", err)
+	}
+	LogInfof("Backed up %d lists to %s", len(backup.Lists), path)
+	return nil
+}
+
+// RestoreBackup uploads the lists of a backup file written to BackupDir, or
+// of a file holding just a JSON array of lists, back to Feedly. A list whose
+// ID is still in Feedly is replaced by a PUT; a list that was deleted since
+// is created again. Requests are rate limited as in a sync, a failed list
+// does not stop the restore, and in dry run mode the changes are only
+// planned, as in SyncToFeedly.
+func RestoreBackup(ctx context.Context, client *http.Client, path string, config Config) (SyncResult, error) {
+	result := SyncResult{RunID: config.RunID, Errors: []ListError{}, Columns: []ColumnCount{}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return result, fmt.Errorf("error reading backup: %v", err)
+	}
+	var backup listBackup
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &backup.Lists)
+	} else {
+		err = json.Unmarshal(data, &backup)
+	}
+	if err != nil {
+		return result, fmt.Errorf("error decoding backup: %v", err)
+	}
+
+	feedlyData, err := FetchFeedlyData(ctx, client, config)
+	if err != nil {
+		return result, err
+	}
+	current := make(map[string]FeedlyList, len(feedlyData))
+	for _, list := range feedlyData {
+		current[list.ID] = list
+	}
+
+	limiter := rate.NewLimiter(rate.Limit(config.RequestsPerSecond), 1)
+	var errs []error
+	for _, list := range backup.Lists {
+		job := listJob{Method: "POST", List: list, Entities: len(list.Entities), Added: len(list.Entities)}
+		if existing, ok := current[list.ID]; ok && list.ID != "" {
+			job.Method = "PUT"
+			job.Added, _ = entityDiff(existing.Entities, list.Entities)
+		} else {
+			job.List.ID = ""
+		}
+		if config.DryRun {
+			result.Plan = append(result.Plan, planChange(job.Method, job.List.Label, job.List.Entities))
+			result.record(job)
+			continue
+		}
+
+		if err := limiter.Wait(ctx); err != nil {
+			return result, err
+		}
+		if stopRequested(ctx) {
+			return result, errors.Join(append(errs, stopError(ctx, &result))...)
+		}
+		id, err := sendList(ctx, client, job.Method, job.List, config)
+		if err != nil {
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+			LogErrorf("Failed to restore list %q: %v", list.Label, err)
+			result.addError(list.Label, job.Entities, err)
+			errs = append(errs, fmt.Errorf("list %q: %w", list.Label, err))
+			continue
+		}
+		LogInfof("Restored list %q", list.Label)
+		result.record(job)
+		if job.Method == "POST" {
+			result.CreatedLists = append(result.CreatedLists, CreatedList{Label: list.Label, ID: id})
+		}
+	}
+	return result, errors.Join(errs...)
+}
@@ -0,0 +1,495 @@
+package feedly
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version is reported in the default User-Agent. The CLI sets it to its
+// own build version at startup.
+var Version = "dev"
+
+// WithRunID returns config with a new random UUID as RunID, unless one is
+// set in the config, and logs the run ID. Every request of the run sends it
+// as X-Request-Id, so the requests of one run can be told apart, e.g. in a
+// support ticket. Call it once per run.
+func WithRunID(config Config) Config {
+	if config.RunID == "" {
+		var id [16]byte
+		if _, err := rand.Read(id[:]); err != nil {
+			LogWarnf("Could not generate a run ID: %v", err)
+			return config
+		}
+		// Version 4, variant 10 as in RFC 4122.
+		id[6] = id[6]&0x0f | 0x40
+		id[8] = id[8]&0x3f | 0x80
+		config.RunID = fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+	}
+	LogInfof("Run ID %s", config.RunID)
+	return config
+}
+
+// maxRetryDelay caps the exponential backoff between retried requests.
+const maxRetryDelay = 30 * time.Second
+
+// NewHTTPClient returns the client shared by all requests of a sync run.
+// Requests go through ProxyURL if it is set and through the proxy from the
+// environment otherwise. Timeout bounds connecting to Feedly, including the
+// TLS handshake; the client itself has no overall timeout, as every request
+// gets its own RequestTimeout from doWithRetry. Server certificates are
+// also accepted if they are signed by a CA in CACertFile, and not verified
+// at all with InsecureSkipVerify, which is meant for testing only.
+func NewHTTPClient(config Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.ProxyURL != "" {
+		// Validate has already checked that the URL parses.
+		proxy, _ := url.Parse(config.ProxyURL)
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if config.CACertFile != "" || config.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if config.CACertFile != "" {
+		// Validate has already checked that the file holds certificates.
+		transport.TLSClientConfig.RootCAs, _ = loadCACerts(config.CACertFile)
+	}
+	if config.InsecureSkipVerify {
+		LogWarnf("WARNING: insecure_skip_verify is set, TLS certificates are NOT verified. Use this for testing only, never in production.")
+		transport.TLSClientConfig.InsecureSkipVerify = true
+	}
+	dialer := &net.Dialer{Timeout: time.Duration(config.Timeout), KeepAlive: 30 * time.Second}
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = time.Duration(config.Timeout)
+	return &http.Client{Transport: transport}
+}
+
+// loadCACerts returns the system's certificate pool with the PEM
+// certificates of path added, for a Feedly proxy with a private CA.
+func loadCACerts(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading ca_cert_file: %v", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("ca_cert_file %s holds no PEM certificates", path)
+	}
+	return pool, nil
+}
+
+// cancelOnClose releases the deadline of a request once its response body
+// has been read and closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// setHeaders adds the content type, the credentials, the User-Agent, the
+// run ID and ExtraHeaders to a Feedly request. Every request builder goes
+// through it. An empty UserAgent falls back to "feedly-asset-sync/<version>".
+// Extra headers are set last and replace any header of the same name.
+func setHeaders(req *http.Request, config Config) {
+	userAgent := config.UserAgent
+	if userAgent == "" {
+		userAgent = "feedly-asset-sync/" + Version
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Set("Authorization", authorization(config))
+	req.Header.Set("User-Agent", userAgent)
+	if config.RunID != "" {
+		req.Header.Set("X-Request-Id", config.RunID)
+	}
+	for name, value := range config.ExtraHeaders {
+		req.Header.Set(name, value)
+	}
+}
+
+// authorization returns the value of the Authorization header: HTTP Basic
+// credentials if AuthScheme is "basic", AuthHeader with the API key in place
+// of {key} if it is set, and AuthScheme, exactly as written, followed by the
+// API key otherwise, e.g. "Bearer <key>" or "Token <key>".
+func authorization(config Config) string {
+	scheme := strings.TrimSpace(config.AuthScheme)
+	switch {
+	case strings.EqualFold(scheme, authSchemeBasic):
+		credentials := config.Username + ":" + config.Password
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+	case config.AuthHeader != "":
+		return strings.ReplaceAll(config.AuthHeader, authKeyPlaceholder, config.APIKey)
+	default:
+		return scheme + " " + config.APIKey
+	}
+}
+
+// doWithRetry sends req and retries it on network errors, 429 and 5xx
+// responses, waiting RetryBaseDelay, then twice that, and so on up to
+// maxRetryDelay. A Retry-After header on the response takes precedence.
+// Other 4xx responses are returned to the caller immediately, and no retry
+// is attempted once the request's context is done. Every attempt, including
+// reading its response body, must finish within RequestTimeout.
+func doWithRetry(client *http.Client, req *http.Request, config Config) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("error resetting request body: %v", err)
+			}
+			req.Body = body
+		}
+
+		// Each attempt gets its own deadline, so a single hung request fails
+		// and is retried while the run as a whole may take as long as it
+		// needs.
+		attemptCtx, cancel := context.WithTimeout(req.Context(), time.Duration(config.RequestTimeout))
+		resp, err := client.Do(req.WithContext(attemptCtx))
+		if err == nil {
+			LogDebugf("%s %s: %d", req.Method, req.URL, resp.StatusCode)
+			resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+		} else {
+			cancel()
+			if req.Context().Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+				err = fmt.Errorf("request timed out after %v: %w", time.Duration(config.RequestTimeout), err)
+			}
+		}
+		if attempt >= config.MaxRetries || !shouldRetry(resp, err) || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		wait := backoffDelay(config.RetryBaseDelay, attempt)
+		if err != nil {
+			LogWarnf("Request %s %s failed: %v", req.Method, req.URL, err)
+		} else {
+			if retryAfter, ok := parseRetryAfter(resp); ok {
+				wait = retryAfter
+			}
+			resp.Body.Close()
+			LogWarnf("Request %s %s returned status %d", req.Method, req.URL, resp.StatusCode)
+		}
+		LogWarnf("Retrying in %v (attempt %d of %d)", wait, attempt+2, config.MaxRetries+1)
+		if err := sleepContext(req.Context(), wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// sleepContext waits for d or until ctx is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// errConflict is wrapped by sendList when Feedly rejects an update because
+// the list was modified since it was fetched.
+var errConflict = errors.New("the list was modified by another client")
+
+// checkStatus turns a 401 or 403 response into an AuthError and a 429 or
+// 5xx response that is still failing after the retries into
+// ErrRateLimited or ErrFeedlyUnavailable.
+func checkStatus(resp *http.Response) error {
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return &AuthError{StatusCode: resp.StatusCode, Detail: responseDetail(resp)}
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("%w (%s)", ErrRateLimited, describeStatus(resp))
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("%w (%s)", ErrFeedlyUnavailable, describeStatus(resp))
+	}
+	return nil
+}
+
+// maxErrorDetail caps how much of an error response ends up in an error
+// message.
+const maxErrorDetail = 300
+
+// responseDetail returns Feedly's explanation of a failed request: the
+// errorMessage field of a JSON body, or else the body itself, truncated to
+// maxErrorDetail bytes. It is empty if the body is.
+func responseDetail(resp *http.Response) string {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var feedlyErr struct {
+		ErrorMessage string `json:"errorMessage"`
+	}
+	detail := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &feedlyErr) == nil && feedlyErr.ErrorMessage != "" {
+		detail = feedlyErr.ErrorMessage
+	}
+	if len(detail) > maxErrorDetail {
+		detail = strings.ToValidUTF8(detail[:maxErrorDetail], "") + "..."
+	}
+	return detail
+}
+
+// describeStatus returns "status <code>" followed by Feedly's explanation,
+// if the response has one. It consumes the response body.
+func describeStatus(resp *http.Response) string {
+	if detail := responseDetail(resp); detail != "" {
+		return fmt.Sprintf("status %d: %s", resp.StatusCode, detail)
+	}
+	return fmt.Sprintf("status %d", resp.StatusCode)
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+func backoffDelay(base Duration, attempt int) time.Duration {
+	delay := time.Duration(base)
+	for i := 0; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as
+// an HTTP date.
+func parseRetryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+// FetchFeedlyData fetches all entity lists, following continuation tokens
+// page by page until the last one.
+func FetchFeedlyData(ctx context.Context, client *http.Client, config Config) ([]FeedlyList, error) {
+	var feedlyData []FeedlyList
+	continuation := ""
+	for {
+		lists, next, err := FetchFeedlyPage(ctx, client, config, continuation)
+		if err != nil {
+			return nil, err
+		}
+		feedlyData = append(feedlyData, lists...)
+		if next == "" || next == continuation {
+			return feedlyData, nil
+		}
+		LogDebugf("Fetched %d Feedly lists, continuing with %q", len(feedlyData), next)
+		continuation = next
+	}
+}
+
+// feedlyPage is a paginated response of the entity lists endpoint.
+type feedlyPage struct {
+	Items        []FeedlyList `json:"items"`
+	Continuation string       `json:"continuation"`
+}
+
+// TestConnection checks the URL and the credentials of config with a
+// single-item, authenticated GET of the Feedly lists. It is not retried so
+// that a bad config is reported right away, and it changes nothing.
+func TestConnection(ctx context.Context, client *http.Client, config Config) error {
+	config.PageSize = 1
+	config.MaxRetries = 0
+	_, _, err := FetchFeedlyPage(ctx, client, config, "")
+	return err
+}
+
+// FetchFeedlyPage fetches up to PageSize lists starting at continuation and
+// returns them with the continuation token of the next page, which is empty
+// on the last page. A plain JSON array is accepted as a single, unpaginated
+// page. The request carries the query parameters of FetchQuery, or
+// details=true if it is empty, besides any already in UploadURL; count and
+// continuation are always set by the pagination.
+func FetchFeedlyPage(ctx context.Context, client *http.Client, config Config, continuation string) ([]FeedlyList, string, error) {
+	target, err := url.Parse(config.UploadURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating request: %v", err)
+	}
+	query := target.Query()
+	if len(config.FetchQuery) == 0 {
+		query.Set("details", "true")
+	}
+	for name, value := range config.FetchQuery {
+		query.Set(name, value)
+	}
+	query.Set("count", strconv.Itoa(config.PageSize))
+	if continuation != "" {
+		query.Set("continuation", continuation)
+	}
+	target.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", target.String(), nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating request: %v", err)
+	}
+
+	req.Header.Add("Accept", "application/json")
+	setHeaders(req, config)
+
+	resp, err := doWithRetry(client, req, config)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+		return nil, "", fmt.Errorf("error fetching Feedly data: %w: %v", ErrFeedlyUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected %s", describeStatus(resp))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading Feedly response: %v", err)
+	}
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		var lists []FeedlyList
+		if err := json.Unmarshal(trimmed, &lists); err != nil {
+			return nil, "", fmt.Errorf("error decoding Feedly response: %v", err)
+		}
+		return lists, "", nil
+	}
+
+	var page feedlyPage
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, "", fmt.Errorf("error decoding Feedly response: %v", err)
+	}
+	return page.Items, page.Continuation, nil
+}
+
+// fitPayload returns how many of entities can be appended to the
+// entities of list while its request body stays within maxBytes; all of
+// them if maxBytes is 0.
+func fitPayload(list FeedlyList, entities []FeedlyEntity, maxBytes int) int {
+	if maxBytes == 0 {
+		return len(entities)
+	}
+	if list.Entities == nil {
+		list.Entities = []FeedlyEntity{}
+	}
+	payload, err := json.Marshal(list)
+	if err != nil {
+		// sendList reports the error when the list is sent.
+		return len(entities)
+	}
+	// Every entity adds its own encoding and, after the first, a comma.
+	size := len(payload)
+	for i, entity := range entities {
+		encoded, err := json.Marshal(entity)
+		if err != nil {
+			return len(entities)
+		}
+		size += len(encoded)
+		if len(list.Entities)+i > 0 {
+			size++
+		}
+		if size > maxBytes {
+			return i
+		}
+	}
+	return len(entities)
+}
+
+// sendList creates (POST), updates (PUT) or deletes (DELETE) a single
+// Feedly list and returns its ID. The ID of a created list is taken from
+// the response body; it is empty if Feedly answered without one. A list
+// whose JSON is larger than MaxPayloadBytes is not sent at all.
+func sendList(ctx context.Context, client *http.Client, method string, list FeedlyList, config Config) (string, error) {
+	action := "updating"
+	switch method {
+	case "POST":
+		action = "creating"
+	case "DELETE":
+		action = "deleting"
+	}
+
+	target := config.UploadURL
+	var body io.Reader
+	if method == "DELETE" {
+		target = fmt.Sprintf("%s/%s", strings.TrimSuffix(config.UploadURL, "/"), url.PathEscape(list.ID))
+	} else {
+		payload, err := json.Marshal(list)
+		if err != nil {
+			return "", fmt.Errorf("error marshaling list: %v", err)
+		}
+		if config.MaxPayloadBytes > 0 && len(payload) > config.MaxPayloadBytes {
+			return "", fmt.Errorf("list %q is %d bytes, more than max_payload_bytes (%d)", list.Label, len(payload), config.MaxPayloadBytes)
+		}
+		body = strings.NewReader(string(payload))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %v", err)
+	}
+
+	setHeaders(req, config)
+
+	resp, err := doWithRetry(client, req, config)
+	if err != nil {
+		return "", fmt.Errorf("error %s list: %w: %v", action, ErrFeedlyUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusConflict || resp.StatusCode == http.StatusPreconditionFailed {
+		return "", fmt.Errorf("error %s list (%s): %w", action, describeStatus(resp), errConflict)
+	}
+	// Feedly answers mutations with 204 or with 200 and a body, so any 2xx
+	// status counts as success.
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("error %s list: unexpected %s", action, describeStatus(resp))
+	}
+	if method == "POST" {
+		var created FeedlyList
+		if err := json.NewDecoder(resp.Body).Decode(&created); err != nil && err != io.EOF {
+			LogWarnf("Could not read the ID of the created list %q: %v", list.Label, err)
+		}
+		return created.ID, nil
+	}
+	return list.ID, nil
+}
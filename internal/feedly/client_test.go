@@ -0,0 +1,189 @@
+package feedly
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Hang until the client gives up.
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	config := testConfig(server.URL)
+	config.RequestTimeout = Duration(50 * time.Millisecond)
+
+	start := time.Now()
+	_, err := FetchFeedlyData(context.Background(), NewHTTPClient(config), config)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("FetchFeedlyData returned %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("the request took %v to time out", elapsed)
+	}
+}
+
+func TestSyncAcceptsAny2xx(t *testing.T) {
+	for _, status := range []int{http.StatusOK, http.StatusNoContent} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			f := newFakeFeedly(t, FeedlyList{ID: "tech", Label: "Tech", Type: defaultListType})
+			f.status = func(r *http.Request, list FeedlyList) int { return status }
+			config := testConfig(f.URL)
+
+			result, err := syncFake(t, f, map[string][]string{"Tech": {"golang"}}, config)
+			if err != nil {
+				t.Fatalf("SyncToFeedly: %v", err)
+			}
+			if result.ListsUpdated != 1 || len(result.Errors) != 0 {
+				t.Errorf("got %d updated and errors %v, want 1 and none", result.ListsUpdated, result.Errors)
+			}
+		})
+	}
+}
+
+func TestSyncRetriesUnavailable(t *testing.T) {
+	f := newFakeFeedly(t, FeedlyList{ID: "tech", Label: "Tech", Type: defaultListType})
+	attempts := 0
+	f.status = func(r *http.Request, list FeedlyList) int {
+		attempts++
+		if attempts < 3 {
+			return http.StatusServiceUnavailable
+		}
+		return 0
+	}
+	config := testConfig(f.URL)
+	config.MaxRetries = 3
+
+	result, err := syncFake(t, f, map[string][]string{"Tech": {"golang"}}, config)
+	if err != nil {
+		t.Fatalf("SyncToFeedly: %v", err)
+	}
+	if attempts != 3 || result.ListsUpdated != 1 {
+		t.Errorf("got %d attempts and %d updated, want 3 and 1", attempts, result.ListsUpdated)
+	}
+}
+
+func TestSyncGivesUpAfterMaxRetries(t *testing.T) {
+	f := newFakeFeedly(t, FeedlyList{ID: "tech", Label: "Tech", Type: defaultListType})
+	f.status = func(r *http.Request, list FeedlyList) int { return http.StatusServiceUnavailable }
+	config := testConfig(f.URL)
+	config.MaxRetries = 2
+
+	result, err := syncFake(t, f, map[string][]string{"Tech": {"golang"}}, config)
+	if !errors.Is(err, ErrFeedlyUnavailable) {
+		t.Errorf("SyncToFeedly returned %v, want ErrFeedlyUnavailable", err)
+	}
+	if got := len(f.sent()); got != 3 || len(result.Errors) != 1 {
+		t.Errorf("got %d attempts and errors %v, want 3 and one error", got, result.Errors)
+	}
+}
+
+func TestSyncDoesNotRetryClientErrors(t *testing.T) {
+	f := newFakeFeedly(t, FeedlyList{ID: "tech", Label: "Tech", Type: defaultListType})
+	f.status = func(r *http.Request, list FeedlyList) int { return http.StatusBadRequest }
+	config := testConfig(f.URL)
+	config.MaxRetries = 3
+
+	if _, err := syncFake(t, f, map[string][]string{"Tech": {"golang"}}, config); err == nil {
+		t.Error("SyncToFeedly succeeded on a 400")
+	}
+	if got := len(f.sent()); got != 1 {
+		t.Errorf("sent %d requests, want 1", got)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	base := Duration(time.Second)
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{3, 8 * time.Second},
+		{10, maxRetryDelay},
+	}
+	for _, test := range tests {
+		if got := backoffDelay(base, test.attempt); got != test.want {
+			t.Errorf("backoffDelay(1s, %d) = %v, want %v", test.attempt, got, test.want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"5", 5 * time.Second, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{"Mon, 02 Jan 2006 15:04:05 GMT", 0, true},
+	}
+	for _, test := range tests {
+		resp := &http.Response{Header: http.Header{}}
+		if test.value != "" {
+			resp.Header.Set("Retry-After", test.value)
+		}
+		got, ok := parseRetryAfter(resp)
+		if got != test.want || ok != test.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", test.value, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestAuthorizationHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   string
+	}{
+		{"default", func(c *Config) {}, "Bearer test-key"},
+		{"verbatim scheme", func(c *Config) { c.AuthScheme = "Token" }, "Token test-key"},
+		{"template", func(c *Config) { c.AuthHeader = "bearer {key}" }, "bearer test-key"},
+		{"basic", func(c *Config) { c.AuthScheme, c.Username, c.Password = "Basic", "user", "pass" }, "Basic dXNlcjpwYXNz"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Values("Authorization")
+				w.Write([]byte(`{"items": []}`))
+			}))
+			defer server.Close()
+			config := testConfig(server.URL)
+			test.modify(&config)
+			if err := config.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+
+			if _, err := FetchFeedlyData(context.Background(), server.Client(), config); err != nil {
+				t.Fatalf("FetchFeedlyData: %v", err)
+			}
+			if len(got) != 1 || got[0] != test.want {
+				t.Errorf("Authorization = %q, want exactly %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadConfigLegacyBearer(t *testing.T) {
+	for scheme, want := range map[string]string{"bearer": "Bearer", "Bearer": "Bearer", "Token": "Token", "BEARER": "BEARER"} {
+		path := writeFile(t, "config.json", `{"auth_scheme": "`+scheme+`"}`)
+		config, err := ReadConfig(path)
+		if err != nil {
+			t.Fatalf("ReadConfig: %v", err)
+		}
+		if config.AuthScheme != want {
+			t.Errorf("auth_scheme %q reads as %q, want %q", scheme, config.AuthScheme, want)
+		}
+	}
+}
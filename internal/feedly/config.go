@@ -0,0 +1,545 @@
+package feedly
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	syncModeAppend  = "append"
+	syncModeReplace = "replace"
+)
+
+// AuthScheme is written verbatim in front of the API key; only "basic" is
+// matched in any case. ReadConfig turns the lowercase authSchemeLegacyBearer
+// that earlier configs hold into authSchemeBearer.
+const (
+	authSchemeBearer       = "Bearer"
+	authSchemeBasic        = "basic"
+	authSchemeLegacyBearer = "bearer"
+)
+
+// authKeyPlaceholder is replaced with the API key in AuthHeader.
+const authKeyPlaceholder = "{key}"
+
+// envReference matches config values such as "${ENV:FEEDLY_API_KEY}" that
+// are read from the environment instead of the config file.
+var envReference = regexp.MustCompile(`^\$\{ENV:([A-Za-z_][A-Za-z0-9_]*)\}$`)
+
+type Config struct {
+	UploadURL           string             `json:"upload_url" yaml:"upload_url"`
+	APIKey              string             `json:"api_key" yaml:"api_key"`
+	APIKeyFile          string             `json:"api_key_file" yaml:"api_key_file"`
+	AuthScheme          string             `json:"auth_scheme" yaml:"auth_scheme"`
+	AuthHeader          string             `json:"auth_header" yaml:"auth_header"`
+	Username            string             `json:"username" yaml:"username"`
+	Password            string             `json:"password" yaml:"password"`
+	CSVPath             string             `json:"csv_path" yaml:"csv_path"`
+	CSVPaths            []string           `json:"csv_paths" yaml:"csv_paths"`
+	MaxRetries          int                `json:"max_retries" yaml:"max_retries"`
+	ConflictRetries     int                `json:"conflict_retries" yaml:"conflict_retries"`
+	RetryBaseDelay      Duration           `json:"retry_base_delay" yaml:"retry_base_delay"`
+	MaxRows             int                `json:"max_rows" yaml:"max_rows"`
+	MaxEntitiesPerList  int                `json:"max_entities_per_list" yaml:"max_entities_per_list"`
+	MaxPayloadBytes     int                `json:"max_payload_bytes" yaml:"max_payload_bytes"`
+	MaxListsPerRun      int                `json:"max_lists_per_run" yaml:"max_lists_per_run"`
+	SharedKeywordLimit  int                `json:"shared_keyword_limit" yaml:"shared_keyword_limit"`
+	MaxKeywordLength    int                `json:"max_keyword_length" yaml:"max_keyword_length"`
+	OnOverlongKeyword   string             `json:"on_overlong_keyword" yaml:"on_overlong_keyword"`
+	DryRun              bool               `json:"dry_run" yaml:"dry_run"`
+	PrefixMatch         bool               `json:"prefix_match" yaml:"prefix_match"`
+	OverflowLabelFormat string             `json:"overflow_label_format" yaml:"overflow_label_format"`
+	Timeout             Duration           `json:"timeout" yaml:"timeout"`
+	RequestTimeout      Duration           `json:"request_timeout" yaml:"request_timeout"`
+	MaxDuration         Duration           `json:"max_duration" yaml:"max_duration"`
+	Delimiter           string             `json:"delimiter" yaml:"delimiter"`
+	Encoding            string             `json:"encoding" yaml:"encoding"`
+	InputFormat         string             `json:"input_format" yaml:"input_format"`
+	CaseSensitiveDedup  bool               `json:"case_sensitive_dedup" yaml:"case_sensitive_dedup"`
+	SyncMode            string             `json:"sync_mode" yaml:"sync_mode"`
+	LogLevel            string             `json:"log_level" yaml:"log_level"`
+	Concurrency         int                `json:"concurrency" yaml:"concurrency"`
+	RequestsPerSecond   float64            `json:"requests_per_second" yaml:"requests_per_second"`
+	PageSize            int                `json:"page_size" yaml:"page_size"`
+	FetchQuery          map[string]string  `json:"fetch_query" yaml:"fetch_query"`
+	NormalizeKeywords   bool               `json:"normalize_keywords" yaml:"normalize_keywords"`
+	LowercaseKeywords   bool               `json:"lowercase_keywords" yaml:"lowercase_keywords"`
+	UserAgent           string             `json:"user_agent" yaml:"user_agent"`
+	StrictColumns       bool               `json:"strict_columns" yaml:"strict_columns"`
+	IncludeColumns      []string           `json:"include_columns" yaml:"include_columns"`
+	ExcludeColumns      []string           `json:"exclude_columns" yaml:"exclude_columns"`
+	ColumnGlob          bool               `json:"column_glob" yaml:"column_glob"`
+	StateFile           string             `json:"state_file" yaml:"state_file"`
+	LabelMapping        map[string]string  `json:"label_mapping" yaml:"label_mapping"`
+	LabelPrefix         string             `json:"label_prefix" yaml:"label_prefix"`
+	LabelSuffix         string             `json:"label_suffix" yaml:"label_suffix"`
+	ListIDs             map[string]string  `json:"list_ids" yaml:"list_ids"`
+	ListTypes           map[string]string  `json:"list_types" yaml:"list_types"`
+	DefaultEntityType   string             `json:"default_entity_type" yaml:"default_entity_type"`
+	EntityTypes         map[string]string  `json:"entity_types" yaml:"entity_types"`
+	ReportPath          string             `json:"report_path" yaml:"report_path"`
+	BackupDir           string             `json:"backup_dir" yaml:"backup_dir"`
+	MetricsPath         string             `json:"metrics_path" yaml:"metrics_path"`
+	PruneMissing        bool               `json:"prune_missing" yaml:"prune_missing"`
+	PrunePattern        string             `json:"prune_pattern" yaml:"prune_pattern"`
+	CellSplitChar       string             `json:"cell_split_char" yaml:"cell_split_char"`
+	WeightSeparator     string             `json:"weight_separator" yaml:"weight_separator"`
+	ProxyURL            string             `json:"proxy_url" yaml:"proxy_url"`
+	CACertFile          string             `json:"ca_cert_file" yaml:"ca_cert_file"`
+	InsecureSkipVerify  bool               `json:"insecure_skip_verify" yaml:"insecure_skip_verify"`
+	ExtraHeaders        map[string]string  `json:"extra_headers" yaml:"extra_headers"`
+	RunID               string             `json:"run_id" yaml:"run_id"`
+	OnlyCreate          bool               `json:"only_create" yaml:"only_create"`
+	RefetchAfterCreate  bool               `json:"refetch_after_create" yaml:"refetch_after_create"`
+	FailOnOrphan        bool               `json:"fail_on_orphan" yaml:"fail_on_orphan"`
+	Profiles            map[string]Profile `json:"profiles" yaml:"profiles"`
+	Force               bool               `json:"-" yaml:"-"` // set by -force, never read from the file
+}
+
+// Profile holds the account of one entry in Profiles. Fields left empty
+// keep the value from the top level of the config.
+type Profile struct {
+	UploadURL string `json:"upload_url" yaml:"upload_url"`
+	APIKey    string `json:"api_key" yaml:"api_key"`
+}
+
+// defaultProfile is the profile LoadConfig uses if the config has one by
+// that name.
+const defaultProfile = "default"
+
+// Duration is a time.Duration that is stored in the config as a string
+// such as "1s" or "500ms".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"1s\": %v", err)
+	}
+	return d.parse(s)
+}
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return fmt.Errorf("duration must be a string like \"1s\": %v", err)
+	}
+	return d.parse(s)
+}
+
+func (d *Duration) parse(s string) error {
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %v", s, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func DefaultConfig() Config {
+	return Config{
+		AuthScheme:          authSchemeBearer,
+		MaxRetries:          3,
+		ConflictRetries:     2,
+		RetryBaseDelay:      Duration(time.Second),
+		MaxRows:             50,
+		MaxEntitiesPerList:  50,
+		MaxKeywordLength:    100,
+		MaxListsPerRun:      100,
+		OnOverlongKeyword:   overlongDrop,
+		OverflowLabelFormat: "{label} {index}",
+		Timeout:             Duration(30 * time.Second),
+		RequestTimeout:      Duration(60 * time.Second),
+		Delimiter:           ",",
+		Encoding:            encodingUTF8,
+		InputFormat:         inputFormatCSV,
+		DefaultEntityType:   defaultEntityType,
+		SyncMode:            syncModeAppend,
+		LogLevel:            "info",
+		Concurrency:         1,
+		RequestsPerSecond:   1,
+		PageSize:            100,
+		NormalizeKeywords:   true,
+	}
+}
+
+// WriteConfigTemplate writes a config file with every supported field set
+// to its default and placeholders for the values the user has to fill in.
+// An existing file is only replaced if force is set.
+func WriteConfigTemplate(path string, force bool) error {
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("%s already exists, use -force to overwrite it", path)
+	}
+
+	config := DefaultConfig()
+	config.UploadURL = "https://api.feedly.com/v3/enterprise/entityLists"
+	config.APIKey = "YOUR FEEDLY API KEY"
+	config.CSVPath = "PATH_TO_CSV"
+	config.CSVPaths = []string{}
+	config.IncludeColumns = []string{}
+	config.ExcludeColumns = []string{}
+	config.LabelMapping = map[string]string{}
+	config.ListIDs = map[string]string{}
+	config.ListTypes = map[string]string{}
+	config.EntityTypes = map[string]string{}
+	config.ExtraHeaders = map[string]string{}
+	config.FetchQuery = map[string]string{"details": "true"}
+	config.Profiles = map[string]Profile{}
+
+	data, err := json.MarshalIndent(config, "", "    ")
+	if err != nil {
+		return fmt.Errorf("error encoding config: %v", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("error writing config: %v", err)
+	}
+	return nil
+}
+
+// Validate checks that the config is complete and usable. The returned
+// error names the offending field, or all of the required fields that are
+// missing, such as for a config of just "{}".
+func (c Config) Validate() error {
+	var missing []string
+	if c.UploadURL == "" {
+		missing = append(missing, "upload_url (in the config or the FEEDLY_UPLOAD_URL environment variable)")
+	}
+	switch scheme := strings.TrimSpace(c.AuthScheme); {
+	case strings.EqualFold(scheme, authSchemeBasic):
+		if c.Username == "" {
+			missing = append(missing, fmt.Sprintf("username (as auth_scheme is %q)", authSchemeBasic))
+		}
+		if c.AuthHeader != "" {
+			return fmt.Errorf("auth_header cannot be combined with auth_scheme %q", authSchemeBasic)
+		}
+	case scheme == "" || strings.ContainsAny(scheme, " \t\r\n"):
+		return fmt.Errorf("auth_scheme must be %q, %q or another single word such as \"Token\", got %q", authSchemeBearer, authSchemeBasic, c.AuthScheme)
+	default:
+		if c.APIKey == "" {
+			missing = append(missing, "api_key (in the config, api_key_file or the FEEDLY_API_KEY environment variable)")
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required fields: %s", strings.Join(missing, ", "))
+	}
+	if u, err := url.Parse(c.UploadURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("upload_url must be an http or https URL, got %q", c.UploadURL)
+	}
+	if c.MaxRows <= 0 {
+		return fmt.Errorf("max_rows must be positive, got %d", c.MaxRows)
+	}
+	if c.MaxEntitiesPerList <= 0 {
+		return fmt.Errorf("max_entities_per_list must be positive, got %d", c.MaxEntitiesPerList)
+	}
+	if strings.Count(c.OverflowLabelFormat, "{label}") != 1 || len(indexPlaceholder.FindAllString(c.OverflowLabelFormat, -1)) != 1 {
+		return fmt.Errorf("overflow_label_format must contain {label} and {index} exactly once, such as \"{label} ({index})\", got %q", c.OverflowLabelFormat)
+	}
+	if delimiter := []rune(c.Delimiter); len(delimiter) != 1 || strings.ContainsRune("\"\r\n", delimiter[0]) {
+		return fmt.Errorf("delimiter must be a single character such as \",\", \";\" or \"\\t\", got %q", c.Delimiter)
+	}
+	if c.SyncMode != syncModeAppend && c.SyncMode != syncModeReplace {
+		return fmt.Errorf("sync_mode must be %q or %q, got %q", syncModeAppend, syncModeReplace, c.SyncMode)
+	}
+	if _, ok := logLevels[c.LogLevel]; !ok {
+		return fmt.Errorf("log_level must be debug, info, warn or error, got %q", c.LogLevel)
+	}
+	if c.Concurrency <= 0 {
+		return fmt.Errorf("concurrency must be positive, got %d", c.Concurrency)
+	}
+	if c.RequestsPerSecond <= 0 {
+		return fmt.Errorf("requests_per_second must be positive, got %v", c.RequestsPerSecond)
+	}
+	for column, listType := range c.ListTypes {
+		if !knownListTypes[listType] {
+			return fmt.Errorf("list_types: unknown list type %q for column %q", listType, column)
+		}
+	}
+	if !knownEntityTypes[c.DefaultEntityType] {
+		return fmt.Errorf("default_entity_type: unknown entity type %q", c.DefaultEntityType)
+	}
+	for column, entityType := range c.EntityTypes {
+		if !knownEntityTypes[entityType] {
+			return fmt.Errorf("entity_types: unknown entity type %q for column %q", entityType, column)
+		}
+	}
+	if c.PruneMissing {
+		if c.PrunePattern == "" {
+			return fmt.Errorf("prune_pattern is required when prune_missing is set, use \".*\" to allow deleting any list")
+		}
+		if _, err := regexp.Compile(c.PrunePattern); err != nil {
+			return fmt.Errorf("prune_pattern: %v", err)
+		}
+	}
+	if c.ProxyURL != "" {
+		u, err := url.Parse(c.ProxyURL)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			return fmt.Errorf("proxy_url must be an http, https or socks5 URL, got %q", c.ProxyURL)
+		}
+	}
+	if c.CACertFile != "" {
+		if _, err := loadCACerts(c.CACertFile); err != nil {
+			return err
+		}
+	}
+	if c.AuthHeader != "" && (!strings.Contains(c.AuthHeader, authKeyPlaceholder) || strings.ContainsAny(c.AuthHeader, "\r\n")) {
+		return fmt.Errorf("auth_header must contain %s for the API key and no line breaks, got %q", authKeyPlaceholder, c.AuthHeader)
+	}
+	for name, value := range c.ExtraHeaders {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") || strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("extra_headers: invalid header %q", name)
+		}
+	}
+	if _, ok := csvEncodings[strings.ToLower(c.Encoding)]; !ok && !strings.EqualFold(c.Encoding, encodingUTF8) {
+		return fmt.Errorf("encoding must be utf-8, windows-1252 or iso-8859-1, got %q", c.Encoding)
+	}
+	if !strings.EqualFold(c.InputFormat, inputFormatCSV) && !strings.EqualFold(c.InputFormat, inputFormatJSONL) {
+		return fmt.Errorf("input_format must be %q or %q, got %q", inputFormatCSV, inputFormatJSONL, c.InputFormat)
+	}
+	if c.MaxKeywordLength <= 0 {
+		return fmt.Errorf("max_keyword_length must be positive, got %d", c.MaxKeywordLength)
+	}
+	if c.OnOverlongKeyword != overlongDrop && c.OnOverlongKeyword != overlongTruncate {
+		return fmt.Errorf("on_overlong_keyword must be %q or %q, got %q", overlongDrop, overlongTruncate, c.OnOverlongKeyword)
+	}
+	if c.MaxListsPerRun < 0 {
+		return fmt.Errorf("max_lists_per_run must not be negative, got %d", c.MaxListsPerRun)
+	}
+	if c.SharedKeywordLimit < 0 {
+		return fmt.Errorf("shared_keyword_limit must not be negative, got %d", c.SharedKeywordLimit)
+	}
+	if c.MaxPayloadBytes < 0 {
+		return fmt.Errorf("max_payload_bytes must not be negative, got %d", c.MaxPayloadBytes)
+	}
+	if c.ConflictRetries < 0 {
+		return fmt.Errorf("conflict_retries must not be negative, got %d", c.ConflictRetries)
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("timeout must be positive, got %v", time.Duration(c.Timeout))
+	}
+	if c.RequestTimeout <= 0 {
+		return fmt.Errorf("request_timeout must be positive, got %v", time.Duration(c.RequestTimeout))
+	}
+	if c.MaxDuration < 0 {
+		return fmt.Errorf("max_duration must not be negative, got %v", time.Duration(c.MaxDuration))
+	}
+	if c.PageSize <= 0 {
+		return fmt.Errorf("page_size must be positive, got %d", c.PageSize)
+	}
+	if c.ColumnGlob {
+		for _, pattern := range append(append([]string{}, c.IncludeColumns...), c.ExcludeColumns...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("include_columns and exclude_columns: invalid pattern %q", pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// CSVFiles returns the CSV files to sync: csv_path followed by csv_paths.
+func (c Config) CSVFiles() []string {
+	var files []string
+	if c.CSVPath != "" {
+		files = append(files, c.CSVPath)
+	}
+	return append(files, c.CSVPaths...)
+}
+
+// ValidateCSVPath checks that csv_path and csv_paths name at least one
+// readable file. It is kept out of Validate because exporting lists does
+// not read the CSV files.
+func (c Config) ValidateCSVPath() error {
+	files := c.CSVFiles()
+	if len(files) == 0 {
+		return fmt.Errorf("csv_path is required")
+	}
+	for _, file := range files {
+		if info, err := os.Stat(file); err != nil {
+			return fmt.Errorf("csv_path: %v", err)
+		} else if info.IsDir() {
+			return fmt.Errorf("csv_path %q is a directory, not a CSV file", file)
+		}
+	}
+	return nil
+}
+
+// ReadAPIKeyFile sets APIKey to the contents of APIKeyFile, with surrounding
+// whitespace trimmed, if APIKeyFile is set. That keeps the key out of a
+// config that is shared or committed, as with Docker secrets. Setting both
+// APIKey and APIKeyFile is an error, as it is unclear which key is meant.
+func ReadAPIKeyFile(config Config) (Config, error) {
+	if config.APIKeyFile == "" {
+		return config, nil
+	}
+	if config.APIKey != "" {
+		return config, fmt.Errorf("api_key and api_key_file are both set, use only one of them")
+	}
+	data, err := os.ReadFile(config.APIKeyFile)
+	if err != nil {
+		return config, fmt.Errorf("error reading api_key_file: %v", err)
+	}
+	config.APIKey = strings.TrimSpace(string(data))
+	if config.APIKey == "" {
+		return config, fmt.Errorf("api_key_file %s is empty", config.APIKeyFile)
+	}
+	return config, nil
+}
+
+// ResolveAPIKey returns the API key to use: the FEEDLY_API_KEY environment
+// variable if it is set, otherwise the configured value with any
+// "${ENV:NAME}" reference replaced by that variable.
+func ResolveAPIKey(apiKey string) (string, error) {
+	if key := os.Getenv("FEEDLY_API_KEY"); key != "" {
+		return key, nil
+	}
+	return expandAPIKey(apiKey)
+}
+
+// expandAPIKey replaces a "${ENV:NAME}" reference in apiKey by that
+// variable.
+func expandAPIKey(apiKey string) (string, error) {
+	if match := envReference.FindStringSubmatch(apiKey); match != nil {
+		key := os.Getenv(match[1])
+		if key == "" {
+			return "", fmt.Errorf("api_key refers to environment variable %s, which is not set", match[1])
+		}
+		return key, nil
+	}
+	return apiKey, nil
+}
+
+// ReadConfig decodes the config file at path without validating it, so that
+// the GUI can still show an incomplete config for the user to fix. Files
+// ending in .yaml or .yml are read as YAML, all others as JSON.
+func ReadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, fmt.Errorf("error opening config: %w: %v", ErrConfigMissing, err)
+		}
+		return config, fmt.Errorf("error opening config: %v", err)
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.NewDecoder(file).Decode(&config)
+	default:
+		err = json.NewDecoder(file).Decode(&config)
+	}
+	if err == io.EOF {
+		// Both decoders report a file without any content as io.EOF.
+		return config, fmt.Errorf("config file %s is empty: run \"init -force\" to write one with every field, or fill in at least upload_url and api_key", path)
+	}
+	if err != nil {
+		return config, fmt.Errorf("error decoding config: %v", err)
+	}
+	if strings.TrimSpace(config.AuthScheme) == authSchemeLegacyBearer {
+		// The example config, init and the GUI wrote "bearer" before the
+		// scheme was sent verbatim; a gateway that really wants it in
+		// lowercase can use AuthHeader "bearer {key}".
+		config.AuthScheme = authSchemeBearer
+	}
+	return config, nil
+}
+
+// LoadConfig reads the config file at path, selects the profile "default"
+// if there is one, takes an empty upload_url from the FEEDLY_UPLOAD_URL
+// environment variable, reads api_key_file, resolves the API key and
+// validates the result.
+func LoadConfig(path string) (Config, error) {
+	return LoadProfile(path, "")
+}
+
+// LoadProfile is LoadConfig for the named profile of Profiles, whose
+// account replaces the one at the top level of the config. An empty name
+// selects the profile "default", or the top level if there is no such
+// profile, so that configs without profiles keep working. FEEDLY_API_KEY
+// only replaces the top-level key, not one the selected profile sets.
+func LoadProfile(path, profile string) (Config, error) {
+	config, err := ReadConfig(path)
+	if err != nil {
+		return config, err
+	}
+	return ApplyProfile(config, profile)
+}
+
+// ApplyProfile does for a config that was already read what LoadProfile
+// does after reading the file, so that a config can be checked before it
+// is written.
+func ApplyProfile(config Config, profile string) (Config, error) {
+	config, profileKey, err := selectProfile(config, profile)
+	if err != nil {
+		return config, fmt.Errorf("invalid config: %v", err)
+	}
+	if config.UploadURL == "" {
+		config.UploadURL = os.Getenv("FEEDLY_UPLOAD_URL")
+	}
+	if config, err = ReadAPIKeyFile(config); err != nil {
+		return config, fmt.Errorf("invalid config: %v", err)
+	}
+	if profileKey {
+		config.APIKey, err = expandAPIKey(config.APIKey)
+	} else {
+		config.APIKey, err = ResolveAPIKey(config.APIKey)
+	}
+	if err != nil {
+		return config, fmt.Errorf("invalid config: %v", err)
+	}
+	if err := config.Validate(); err != nil {
+		return config, fmt.Errorf("invalid config: %v", err)
+	}
+	return config, nil
+}
+
+// ProfileNames returns the names of the profiles of config, sorted.
+func ProfileNames(config Config) []string {
+	names := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// selectProfile applies the named profile to config, as described for
+// LoadProfile, and reports whether the profile set the API key.
+func selectProfile(config Config, name string) (Config, bool, error) {
+	if name == "" {
+		if _, ok := config.Profiles[defaultProfile]; !ok {
+			return config, false, nil
+		}
+		name = defaultProfile
+	}
+	profile, ok := config.Profiles[name]
+	if !ok {
+		names := ProfileNames(config)
+		if len(names) == 0 {
+			return config, false, fmt.Errorf("profile %q not found, the config has no profiles", name)
+		}
+		return config, false, fmt.Errorf("profile %q not found, the config has %s", name, strings.Join(names, ", "))
+	}
+	if profile.UploadURL != "" {
+		config.UploadURL = profile.UploadURL
+	}
+	if profile.APIKey != "" {
+		// The profile's key replaces a top-level api_key_file as well.
+		config.APIKey, config.APIKeyFile = profile.APIKey, ""
+	}
+	return config, profile.APIKey != "", nil
+}
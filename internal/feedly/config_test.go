@@ -0,0 +1,153 @@
+package feedly
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   string
+	}{
+		{"missing upload_url", func(c *Config) { c.UploadURL = "" }, "upload_url"},
+		{"relative upload_url", func(c *Config) { c.UploadURL = "feedly.example.com/lists" }, "upload_url must be an http or https URL"},
+		{"ftp upload_url", func(c *Config) { c.UploadURL = "ftp://feedly.example.com" }, "upload_url must be an http or https URL"},
+		{"missing api_key", func(c *Config) { c.APIKey = "" }, "api_key"},
+		{"basic without username", func(c *Config) { c.AuthScheme = "basic" }, "username"},
+		{"two-word auth_scheme", func(c *Config) { c.AuthScheme = "Bearer token" }, "auth_scheme"},
+		{"zero max_entities_per_list", func(c *Config) { c.MaxEntitiesPerList = 0 }, "max_entities_per_list"},
+		{"unknown sync_mode", func(c *Config) { c.SyncMode = "merge" }, "sync_mode"},
+		{"negative max_payload_bytes", func(c *Config) { c.MaxPayloadBytes = -1 }, "max_payload_bytes"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := testConfig("https://feedly.example.com/lists")
+			test.modify(&config)
+			err := config.Validate()
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("Validate() = %v, want an error naming %s", err, test.want)
+			}
+		})
+	}
+
+	if err := testConfig("https://feedly.example.com/lists").Validate(); err != nil {
+		t.Errorf("Validate() of a valid config = %v", err)
+	}
+}
+
+func TestValidateCSVPath(t *testing.T) {
+	config := testConfig("https://feedly.example.com/lists")
+	if err := config.ValidateCSVPath(); err == nil || !strings.Contains(err.Error(), "csv_path is required") {
+		t.Errorf("ValidateCSVPath() without csv_path = %v", err)
+	}
+	config.CSVPath = filepath.Join(t.TempDir(), "missing.csv")
+	if err := config.ValidateCSVPath(); err == nil || !strings.Contains(err.Error(), "csv_path") {
+		t.Errorf("ValidateCSVPath() of a missing file = %v", err)
+	}
+	config.CSVPath = t.TempDir()
+	if err := config.ValidateCSVPath(); err == nil || !strings.Contains(err.Error(), "is a directory") {
+		t.Errorf("ValidateCSVPath() of a directory = %v", err)
+	}
+	config.CSVPath = writeFile(t, "data.csv", "Tech\ngolang\n")
+	if err := config.ValidateCSVPath(); err != nil {
+		t.Errorf("ValidateCSVPath() of a file = %v", err)
+	}
+}
+
+func TestLoadConfigValidates(t *testing.T) {
+	t.Setenv("FEEDLY_API_KEY", "")
+	t.Setenv("FEEDLY_UPLOAD_URL", "")
+	path := writeFile(t, "config.json", `{"upload_url": "https://feedly.example.com/lists"}`)
+
+	_, err := LoadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), "api_key") {
+		t.Errorf("LoadConfig() without api_key = %v, want an error naming api_key", err)
+	}
+}
+
+func TestReadConfigEmptyFile(t *testing.T) {
+	for _, name := range []string{"config.json", "config.yaml"} {
+		path := writeFile(t, name, "")
+		_, err := ReadConfig(path)
+		if err == nil || !strings.Contains(err.Error(), "is empty") || !strings.Contains(err.Error(), "init") {
+			t.Errorf("ReadConfig(%s) of an empty file = %v, want a hint to run init", name, err)
+		}
+	}
+}
+
+func TestLoadConfigEmptyObject(t *testing.T) {
+	t.Setenv("FEEDLY_API_KEY", "")
+	t.Setenv("FEEDLY_UPLOAD_URL", "")
+	path := writeFile(t, "config.json", "{}")
+
+	_, err := LoadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), "missing required fields: upload_url") || !strings.Contains(err.Error(), "api_key") {
+		t.Errorf("LoadConfig({}) = %v, want both missing fields named", err)
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	t.Setenv("FEEDLY_API_KEY", "")
+	t.Setenv("FEEDLY_UPLOAD_URL", "")
+	path := writeFile(t, "config.json", `{
+		"upload_url": "https://feedly.example.com/top",
+		"api_key": "top-key",
+		"profiles": {
+			"default": {"api_key": "default-key"},
+			"work": {"upload_url": "https://work.example.com/lists", "api_key": "work-key"}
+		}
+	}`)
+
+	tests := []struct {
+		profile, uploadURL, apiKey string
+	}{
+		{"", "https://feedly.example.com/top", "default-key"},
+		{"default", "https://feedly.example.com/top", "default-key"},
+		{"work", "https://work.example.com/lists", "work-key"},
+	}
+	for _, test := range tests {
+		config, err := LoadProfile(path, test.profile)
+		if err != nil {
+			t.Errorf("LoadProfile(%q): %v", test.profile, err)
+			continue
+		}
+		if config.UploadURL != test.uploadURL || config.APIKey != test.apiKey {
+			t.Errorf("LoadProfile(%q) = %s, %s, want %s, %s", test.profile, config.UploadURL, config.APIKey, test.uploadURL, test.apiKey)
+		}
+	}
+
+	_, err := LoadProfile(path, "home")
+	if err == nil || !strings.Contains(err.Error(), `profile "home" not found, the config has default, work`) {
+		t.Errorf("LoadProfile(home) = %v, want the available profiles listed", err)
+	}
+
+	// FEEDLY_API_KEY stands in for the top-level key only.
+	t.Setenv("FEEDLY_API_KEY", "env-key")
+	if config, err := LoadProfile(path, "work"); err != nil || config.APIKey != "work-key" {
+		t.Errorf("LoadProfile(work) with FEEDLY_API_KEY = %s, %v, want work-key", config.APIKey, err)
+	}
+	path = writeFile(t, "keyless.json", `{
+		"upload_url": "https://feedly.example.com/top",
+		"profiles": {"work": {"upload_url": "https://work.example.com/lists"}}
+	}`)
+	if config, err := LoadProfile(path, "work"); err != nil || config.APIKey != "env-key" {
+		t.Errorf("LoadProfile(work) of a profile without a key = %s, %v, want env-key", config.APIKey, err)
+	}
+}
+
+func TestLoadProfileFlatConfig(t *testing.T) {
+	t.Setenv("FEEDLY_API_KEY", "")
+	t.Setenv("FEEDLY_UPLOAD_URL", "")
+	path := writeFile(t, "config.json", `{"upload_url": "https://feedly.example.com/lists", "api_key": "key"}`)
+
+	config, err := LoadProfile(path, "")
+	if err != nil || config.APIKey != "key" {
+		t.Errorf("LoadProfile of a flat config = %s, %v, want key", config.APIKey, err)
+	}
+	if _, err := LoadProfile(path, "work"); err == nil || !strings.Contains(err.Error(), "the config has no profiles") {
+		t.Errorf("LoadProfile(work) of a flat config = %v", err)
+	}
+}
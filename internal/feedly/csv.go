@@ -0,0 +1,874 @@
+package feedly
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// entityTypeHint matches a "Label:type" column header, such as "Tech:source",
+// that names the Feedly entity type of the column. Only the types in
+// knownEntityTypes count as a hint.
+var entityTypeHint = regexp.MustCompile(`^(.+):([A-Za-z]+)$`)
+
+// defaultEntityType is the default DefaultEntityType, used for columns
+// whose header carries no type hint.
+const defaultEntityType = "customKeyword"
+
+// knownEntityTypes are the entity types DefaultEntityType and column header
+// hints accept.
+var knownEntityTypes = map[string]bool{
+	"customKeyword":   true,
+	"topic":           true,
+	"source":          true,
+	"organization":    true,
+	"technology":      true,
+	"threatActor":     true,
+	"malwareFamily":   true,
+	"vulnerability":   true,
+	"location":        true,
+	"publication":     true,
+	"industry":        true,
+	"attackTechnique": true,
+}
+
+// encodingUTF8 is the default Encoding. CSV files in it are read as they
+// are, but rejected if they are not valid UTF-8.
+const encodingUTF8 = "utf-8"
+
+// csvEncodings are the encodings Encoding accepts besides encodingUTF8.
+// Files in them are transcoded to UTF-8 while they are read.
+var csvEncodings = map[string]encoding.Encoding{
+	"windows-1252": charmap.Windows1252,
+	"iso-8859-1":   charmap.ISO8859_1,
+}
+
+// ReadCSVData reads the CSV files and merges them into one set of columns.
+// Columns with the same header are concatenated in file order before
+// duplicates are removed, so their entries are unioned. Files without data
+// rows are logged and contribute only their headers; if no file has any data
+// rows, ErrNoDataRows is returned.
+func ReadCSVData(ctx context.Context, filenames []string, config Config) (map[string][]string, error) {
+	data := make(map[string][]string)
+	withRows := 0
+	for _, filename := range filenames {
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, fmt.Errorf("error opening CSV: %v", err)
+		}
+		columns, err := ParseInput(ctx, file, config)
+		file.Close()
+		if errors.Is(err, ErrNoDataRows) {
+			LogWarnf("Warning: %s has no data rows", filename)
+			MergeColumns(data, columns)
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		MergeColumns(data, columns)
+		withRows++
+	}
+	if withRows == 0 {
+		return nil, ErrNoDataRows
+	}
+
+	PrepareColumns(data, config)
+
+	return data, nil
+}
+
+// ParseCSV reads one CSV file into a map from header to the non-empty
+// entries of that column. Columns with a blank header, such as the trailing
+// ones spreadsheet exports add, are skipped. A zero-byte file is an error. A
+// file with a header row but no data rows returns its columns together with
+// ErrNoDataRows, so that callers can skip it without treating it as a
+// failure.
+func ParseCSV(ctx context.Context, r io.Reader, config Config) (map[string][]string, error) {
+	return parseColumns(ctx, r, config, scanCSV)
+}
+
+// parseColumns is ParseCSV for input read by scan.
+func parseColumns(ctx context.Context, r io.Reader, config Config, scan scanFunc) (map[string][]string, error) {
+	data := make(map[string][]string)
+	headers, rows, err := scan(ctx, r, config, func(headers, record []string, row int) error {
+		if err := checkFieldCount(record, headers, row, config); err != nil {
+			return err
+		}
+		for i, value := range record {
+			if i < len(headers) && !blankHeader(headers[i]) {
+				data[headers[i]] = append(data[headers[i]], splitCell(value, config)...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDuplicateHeaders(headers, config); err != nil {
+		return nil, err
+	}
+
+	for i, header := range headers {
+		if blankHeader(header) {
+			LogDebugf("Skipping column %d, its header is blank", i+1)
+			continue
+		}
+		if data[header] == nil {
+			data[header] = []string{}
+		}
+	}
+	if rows == 0 {
+		return data, ErrNoDataRows
+	}
+	filled := make(map[string]bool, len(data))
+	for header, entries := range data {
+		filled[header] = len(entries) > 0
+	}
+	warnEmptyColumns(headers, filled)
+	return data, nil
+}
+
+// blankHeader reports whether a CSV header is empty or only whitespace.
+// Such columns are skipped.
+func blankHeader(header string) bool {
+	return strings.TrimSpace(header) == ""
+}
+
+// warnEmptyColumns names the columns of a file with data rows in a warning
+// if none of them has a single entry, as the file then holds nothing to
+// sync. filled holds the headers of the columns that have entries. Empty
+// columns next to filled ones are skipped later with a debug line.
+func warnEmptyColumns(headers []string, filled map[string]bool) {
+	var empty []string
+	for _, header := range headers {
+		if filled[header] {
+			return
+		}
+		if !blankHeader(header) {
+			empty = append(empty, header)
+		}
+	}
+	if len(empty) == 0 {
+		return
+	}
+	LogWarnf("Warning: all cells of the CSV columns are empty: %s", strings.Join(empty, ", "))
+}
+
+// scanCSV reads the header row of r and calls visit for every data row,
+// numbered from 2 for the first row after the headers. It returns the
+// headers and the number of data rows.
+func scanCSV(ctx context.Context, r io.Reader, config Config, visit func(headers, record []string, row int) error) (headers []string, rows int, err error) {
+	reader := csv.NewReader(decodeInput(r, config))
+	reader.Comma = []rune(config.Delimiter)[0]
+	reader.FieldsPerRecord = -1
+	headers, err = reader.Read()
+	if err == io.EOF {
+		return nil, 0, fmt.Errorf("%w: CSV file is empty", ErrInvalidCSV)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: error reading CSV headers: %v", ErrInvalidCSV, err)
+	}
+	if err := checkUTF8(headers, 1); err != nil {
+		return nil, 0, err
+	}
+
+	for row := 2; ; row++ {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+
+		record, err := reader.Read()
+		if err == io.EOF {
+			return headers, row - 2, nil
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: error reading CSV row: %v", ErrInvalidCSV, err)
+		}
+		if err := checkUTF8(record, row); err != nil {
+			return nil, 0, err
+		}
+		if err := visit(headers, record, row); err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+// checkUTF8 rejects a row with a field that is not valid UTF-8, which is
+// what a file in another encoding looks like when it is read as UTF-8, or
+// that holds the replacement character U+FFFD, which is left behind when
+// such a file was already decoded, as the GUI's file reader does. Uploading
+// such a field would put garbled keywords into Feedly.
+func checkUTF8(record []string, row int) error {
+	for _, field := range record {
+		if !utf8.ValidString(field) || strings.ContainsRune(field, utf8.RuneError) {
+			return fmt.Errorf("%w: CSV row %d is not valid UTF-8, set encoding to the encoding of the file, e.g. windows-1252", ErrInvalidCSV, row)
+		}
+	}
+	return nil
+}
+
+// decodeInput skips a byte order mark at the start of r and transcodes it
+// from Encoding to UTF-8.
+func decodeInput(r io.Reader, config Config) io.Reader {
+	decoded := stripBOM(r)
+	if enc, ok := csvEncodings[strings.ToLower(config.Encoding)]; ok {
+		decoded = enc.NewDecoder().Reader(decoded)
+	}
+	return decoded
+}
+
+// scanFile is scanCSV, or scanJSONL if InputFormat is "jsonl", for the file
+// filename.
+func scanFile(ctx context.Context, filename string, config Config, visit func(headers, record []string, row int) error) ([]string, int, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error opening CSV: %v", err)
+	}
+	defer file.Close()
+
+	headers, rows, err := inputScanner(config)(ctx, file, config, visit)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+		return nil, 0, fmt.Errorf("%s: %w", filename, err)
+	}
+	return headers, rows, nil
+}
+
+// ColumnIterator reads the columns of CSV files in batches. Only the
+// headers are kept between calls: every call to NextBatch reads the files
+// once and keeps just the entries of the next batch of columns, so memory
+// use is bounded by the batch rather than by the whole file.
+type ColumnIterator struct {
+	filenames []string
+	config    Config
+	headers   []string
+	filled    map[string]bool
+	next      int
+	warnings  []string
+	dropped   int
+	capped    map[string]int
+	spread    keywordSpread
+}
+
+// NewColumnIterator reads the files once to collect the headers of the
+// selected columns and to check every row, as ReadCSVData does. It returns
+// ErrNoDataRows if none of the files has any data rows.
+func NewColumnIterator(ctx context.Context, filenames []string, config Config) (*ColumnIterator, error) {
+	seen := make(map[string]bool)
+	it := &ColumnIterator{filenames: filenames, config: config, filled: make(map[string]bool)}
+	withRows := 0
+	for _, filename := range filenames {
+		filled := make(map[string]bool)
+		headers, rows, err := scanFile(ctx, filename, config, func(headers, record []string, row int) error {
+			for i, value := range record {
+				if i < len(headers) && !blankHeader(headers[i]) && len(splitCell(value, config)) > 0 {
+					filled[headers[i]] = true
+					it.filled[headers[i]] = true
+				}
+			}
+			return checkFieldCount(record, headers, row, config)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := checkDuplicateHeaders(headers, config); err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		if rows == 0 {
+			LogWarnf("Warning: %s has no data rows", filename)
+		} else {
+			withRows++
+		}
+		for i, header := range headers {
+			if blankHeader(header) {
+				LogDebugf("Skipping column %d of %s, its header is blank", i+1, filename)
+				continue
+			}
+			if seen[header] {
+				continue
+			}
+			seen[header] = true
+			if !columnSelected(header, config) {
+				LogDebugf("Skipping column %q", header)
+				continue
+			}
+			it.headers = append(it.headers, header)
+		}
+		if rows > 0 {
+			warnEmptyColumns(headers, filled)
+		}
+	}
+	if withRows == 0 {
+		return nil, ErrNoDataRows
+	}
+	sort.Strings(it.headers)
+	return it, nil
+}
+
+// Headers returns the headers of the selected columns in the order NextBatch
+// returns them.
+func (it *ColumnIterator) Headers() []string {
+	return it.headers
+}
+
+// FilledHeaders returns the headers of the selected columns that have at
+// least one entry in one of the files, sorted.
+func (it *ColumnIterator) FilledHeaders() []string {
+	var filled []string
+	for _, header := range it.headers {
+		if it.filled[header] {
+			filled = append(filled, header)
+		}
+	}
+	return filled
+}
+
+// NextBatch returns the next n columns, or all remaining columns if n is not
+// positive, with their entries merged across the files and prepared as by
+// PrepareColumns. The files are read once per call. The batch is empty once
+// every column has been returned.
+func (it *ColumnIterator) NextBatch(ctx context.Context, n int) (map[string][]string, error) {
+	end := len(it.headers)
+	if n > 0 && it.next+n < end {
+		end = it.next + n
+	}
+	headers := it.headers[it.next:end]
+	it.next = end
+
+	batch := make(map[string][]string, len(headers))
+	for _, header := range headers {
+		batch[header] = nil
+	}
+	if len(batch) == 0 {
+		return batch, nil
+	}
+	for _, filename := range it.filenames {
+		_, _, err := scanFile(ctx, filename, it.config, func(fileHeaders, record []string, row int) error {
+			for i, value := range record {
+				if i >= len(fileHeaders) {
+					continue
+				}
+				if entries, ok := batch[fileHeaders[i]]; ok {
+					batch[fileHeaders[i]] = append(entries, splitCell(value, it.config)...)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if it.spread == nil {
+		it.spread = make(keywordSpread)
+	}
+	for _, header := range headers {
+		entries, warnings, dropped, capped := prepareColumn(header, batch[header], it.config)
+		batch[header] = entries
+		it.warnings = append(it.warnings, warnings...)
+		it.dropped += dropped
+		it.spread.add(header, entries, it.config)
+		if capped > 0 {
+			if it.capped == nil {
+				it.capped = make(map[string]int)
+			}
+			it.capped[header] = capped
+		}
+	}
+	return batch, nil
+}
+
+// Reset starts the iteration over from the first column.
+func (it *ColumnIterator) Reset() {
+	it.next = 0
+	it.warnings = nil
+	it.dropped = 0
+	it.capped = nil
+	it.spread = nil
+}
+
+// Warnings returns the warnings about the columns returned so far, as
+// PrepareColumns returns them.
+func (it *ColumnIterator) Warnings() []string {
+	return it.warnings
+}
+
+// Dropped returns the number of over-long keywords dropped from the columns
+// returned so far, as PrepareColumns returns it.
+func (it *ColumnIterator) Dropped() int {
+	return it.dropped
+}
+
+// SharedKeywords returns the keywords that appear in more than
+// SharedKeywordLimit of the columns returned so far, and logs a warning for
+// each of them.
+func (it *ColumnIterator) SharedKeywords() []SharedKeyword {
+	return it.spread.shared(it.config)
+}
+
+// Capped returns the number of entries of the column header, if it was
+// returned already, that were cut off because the column has more than
+// MaxRows entries.
+func (it *ColumnIterator) Capped(header string) int {
+	return it.capped[header]
+}
+
+// splitCell returns the entries of a cell: the cell itself, or its parts
+// split on CellSplitChar if that is set. Empty entries are skipped.
+func splitCell(value string, config Config) []string {
+	parts := []string{value}
+	if config.CellSplitChar != "" {
+		parts = strings.Split(value, config.CellSplitChar)
+	}
+
+	var entries []string
+	for _, part := range parts {
+		if strings.TrimSpace(part) != "" {
+			entries = append(entries, part)
+		}
+	}
+	return entries
+}
+
+// splitWeight splits an entry such as "golang@0.8" into the keyword and
+// its salience if WeightSeparator ("@" here) is set. An entry without a
+// separator, or with something other than a positive number after the last
+// one, is a plain keyword with no salience.
+func splitWeight(entry string, config Config) (string, float64) {
+	if config.WeightSeparator == "" {
+		return entry, 0
+	}
+	i := strings.LastIndex(entry, config.WeightSeparator)
+	if i < 0 {
+		return entry, 0
+	}
+	weight, err := strconv.ParseFloat(strings.TrimSpace(entry[i+len(config.WeightSeparator):]), 64)
+	if err != nil || weight <= 0 || math.IsInf(weight, 0) || math.IsNaN(weight) {
+		return entry, 0
+	}
+	return strings.TrimSpace(entry[:i]), weight
+}
+
+// MergeColumns appends the entries of every column in src to the column
+// with the same header in dst.
+func MergeColumns(dst, src map[string][]string) {
+	for header, entries := range src {
+		dst[header] = append(dst[header], entries...)
+	}
+}
+
+// checkFieldCount compares the number of fields in a data row with the
+// number of headers. Rows count from 1 for the header row. With
+// StrictColumns a mismatch is an error; otherwise it is logged and fields
+// without a header are ignored.
+func checkFieldCount(record, headers []string, row int, config Config) error {
+	if len(record) == len(headers) {
+		return nil
+	}
+	if config.StrictColumns {
+		return fmt.Errorf("%w: CSV row %d has %d fields, but there are %d headers", ErrInvalidCSV, row, len(record), len(headers))
+	}
+	if len(record) > len(headers) {
+		LogWarnf("CSV row %d has %d fields, but there are only %d headers; the extra fields are ignored", row, len(record), len(headers))
+	} else {
+		LogWarnf("CSV row %d has %d fields, but there are %d headers", row, len(record), len(headers))
+	}
+	return nil
+}
+
+// checkDuplicateHeaders looks for headers that appear more than once in
+// one file. With StrictColumns that is an error; otherwise it is logged and
+// the columns are merged like columns of different files, with duplicates
+// removed.
+func checkDuplicateHeaders(headers []string, config Config) error {
+	counts := make(map[string]int, len(headers))
+	for _, header := range headers {
+		if blankHeader(header) {
+			continue
+		}
+		counts[header]++
+		if counts[header] != 2 {
+			continue
+		}
+		if config.StrictColumns {
+			return fmt.Errorf("%w: CSV header %q appears more than once", ErrInvalidCSV, header)
+		}
+		LogWarnf("CSV header %q appears more than once; its columns are merged", header)
+	}
+	return nil
+}
+
+// stripBOM skips a leading UTF-8 byte order mark, which Excel on Windows
+// writes and which would otherwise end up in the first header.
+func stripBOM(r io.Reader) io.Reader {
+	buffered := bufio.NewReader(r)
+	if bom, err := buffered.Peek(3); err == nil && bytes.Equal(bom, []byte("\xef\xbb\xbf")) {
+		buffered.Discard(3)
+	}
+	return buffered
+}
+
+// PrepareColumns drops the columns that are not selected by IncludeColumns
+// and ExcludeColumns, normalizes the entries of every remaining column,
+// drops or truncates keywords longer than MaxKeywordLength, removes
+// duplicates, keeping the first occurrence, and only then truncates each
+// column to MaxRows entries. Normalizing first lets "  Tech " and "tech"
+// collapse into one entry. Empty columns are kept, with no entries, and
+// skipped by the sync. It returns a warning for every truncated column and
+// every column with over-long keywords, which is also logged, the number
+// of keywords that were dropped for their length and the number of entries
+// cut off by MaxRows per truncated column, for SyncResult.CapColumns.
+func PrepareColumns(data map[string][]string, config Config) (warnings []string, dropped int, capped map[string]int) {
+	for header, entries := range data {
+		if !columnSelected(header, config) {
+			LogDebugf("Skipping column %q", header)
+			delete(data, header)
+			continue
+		}
+		var columnWarnings []string
+		var columnDropped, columnCapped int
+		data[header], columnWarnings, columnDropped, columnCapped = prepareColumn(header, entries, config)
+		warnings = append(warnings, columnWarnings...)
+		dropped += columnDropped
+		if columnCapped > 0 {
+			if capped == nil {
+				capped = make(map[string]int)
+			}
+			capped[header] = columnCapped
+		}
+	}
+	sort.Strings(warnings)
+	return warnings, dropped, capped
+}
+
+// SharedKeyword is a keyword that appears in more than SharedKeywordLimit
+// columns, which may be a copy and paste mistake and makes Feedly match the
+// keyword once for every list. It is only reported; the keyword is still
+// uploaded to every column's list.
+type SharedKeyword struct {
+	Keyword string   `json:"keyword"`
+	Columns []string `json:"columns"`
+}
+
+// keywordSpread maps every keyword, without its weight, to the columns it
+// appears in. It is only filled if SharedKeywordLimit is set.
+type keywordSpread map[string][]string
+
+// add records the prepared entries of the column header.
+func (s keywordSpread) add(header string, entries []string, config Config) {
+	if config.SharedKeywordLimit == 0 {
+		return
+	}
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		keyword, _ := splitWeight(entry, config)
+		if !seen[keyword] {
+			seen[keyword] = true
+			s[keyword] = append(s[keyword], header)
+		}
+	}
+}
+
+// shared returns the keywords that appear in more than SharedKeywordLimit
+// columns, sorted by keyword, and logs a warning for each of them.
+func (s keywordSpread) shared(config Config) []SharedKeyword {
+	if config.SharedKeywordLimit == 0 {
+		return nil
+	}
+	var shared []SharedKeyword
+	for keyword, columns := range s {
+		if len(columns) > config.SharedKeywordLimit {
+			sort.Strings(columns)
+			shared = append(shared, SharedKeyword{Keyword: keyword, Columns: columns})
+		}
+	}
+	sort.Slice(shared, func(i, j int) bool { return shared[i].Keyword < shared[j].Keyword })
+	for _, keyword := range shared {
+		LogWarnf("Warning: keyword %q appears in %d columns: %s", keyword.Keyword, len(keyword.Columns), strings.Join(keyword.Columns, ", "))
+	}
+	return shared
+}
+
+// prepareColumn normalizes, shortens and dedupes the entries of one column
+// and caps them at MaxRows. It returns warnings if keywords were too long or
+// entries were dropped, the number of keywords dropped for their length and
+// the number of entries cut off by MaxRows.
+func prepareColumn(header string, entries []string, config Config) (prepared, warnings []string, dropped, capped int) {
+	entries = normalizeEntries(entries, config)
+	entries, overlong := limitKeywordLength(entries, config)
+	if overlong > 0 {
+		warning := fmt.Sprintf("Column %q has %d keywords longer than %d characters. Truncated them.", header, overlong, config.MaxKeywordLength)
+		if config.OnOverlongKeyword == overlongDrop {
+			warning = fmt.Sprintf("Column %q has %d keywords longer than %d characters. Dropped them.", header, overlong, config.MaxKeywordLength)
+		}
+		LogWarnf("Warning: %s", warning)
+		warnings = append(warnings, warning)
+	}
+	if config.OnOverlongKeyword == overlongDrop {
+		dropped = overlong
+	}
+	entries = dedupeEntries(header, entries, config)
+	var warning string
+	if len(entries) > config.MaxRows {
+		capped = len(entries) - config.MaxRows
+		warning = fmt.Sprintf("Column %q has more than %d entries. Dropped %d excess entries.", header, config.MaxRows, capped)
+		entries = entries[:config.MaxRows]
+	}
+	if len(entries) == 0 {
+		LogDebugf("Skipping column %q, all of its cells are empty", header)
+	}
+	if warning != "" {
+		LogWarnf("Warning: %s", warning)
+		warnings = append(warnings, warning)
+	}
+	return entries, warnings, dropped, capped
+}
+
+// Policies for keywords longer than MaxKeywordLength.
+const (
+	overlongDrop     = "drop"
+	overlongTruncate = "truncate"
+)
+
+// limitKeywordLength drops the keywords longer than MaxKeywordLength
+// characters or, if OnOverlongKeyword is "truncate", cuts them to that
+// length, as Feedly would reject the whole list otherwise. A weight after
+// WeightSeparator does not count towards the length and is kept. It returns
+// the number of keywords that were too long.
+func limitKeywordLength(entries []string, config Config) ([]string, int) {
+	limited := make([]string, 0, len(entries))
+	overlong := 0
+	for _, entry := range entries {
+		text, weight := splitWeight(entry, config)
+		runes := []rune(text)
+		if len(runes) <= config.MaxKeywordLength {
+			limited = append(limited, entry)
+			continue
+		}
+		overlong++
+		if config.OnOverlongKeyword == overlongDrop {
+			continue
+		}
+		entry = strings.TrimSpace(string(runes[:config.MaxKeywordLength]))
+		if weight != 0 {
+			entry += config.WeightSeparator + strconv.FormatFloat(weight, 'g', -1, 64)
+		}
+		limited = append(limited, entry)
+	}
+	return limited, overlong
+}
+
+// columnSelected reports whether a column is synced: it must match one of
+// IncludeColumns, if any are set, and none of ExcludeColumns. Names match
+// exactly, or as path.Match patterns if ColumnGlob is set.
+func columnSelected(header string, config Config) bool {
+	matchesAny := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			if config.ColumnGlob {
+				if ok, _ := path.Match(pattern, header); ok {
+					return true
+				}
+			} else if pattern == header {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(config.IncludeColumns) > 0 && !matchesAny(config.IncludeColumns) {
+		return false
+	}
+	return !matchesAny(config.ExcludeColumns)
+}
+
+// normalizeEntries trims and collapses whitespace in every entry if
+// NormalizeKeywords is set and lowercases it if LowercaseKeywords is set.
+// Entries that end up empty are dropped.
+func normalizeEntries(entries []string, config Config) []string {
+	if !config.NormalizeKeywords && !config.LowercaseKeywords {
+		return entries
+	}
+
+	normalized := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if config.NormalizeKeywords {
+			entry = strings.Join(strings.Fields(entry), " ")
+		}
+		if config.LowercaseKeywords {
+			entry = strings.ToLower(entry)
+		}
+		if entry != "" {
+			normalized = append(normalized, entry)
+		}
+	}
+	return normalized
+}
+
+// dedupeEntries removes repeated entries, keeping the first. Entries are
+// compared without their weight, so "go@0.5" and "go" are duplicates.
+func dedupeEntries(header string, entries []string, config Config) []string {
+	seen := make(map[string]bool, len(entries))
+	unique := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		key, _ := splitWeight(entry, config)
+		if !config.CaseSensitiveDedup {
+			key = strings.ToLower(key)
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, entry)
+	}
+
+	if removed := len(entries) - len(unique); removed > 0 {
+		LogInfof("Removed %d duplicate entries from column %q", removed, header)
+	}
+	return unique
+}
+
+// WriteListsCSV writes the lists in the format ReadCSVData consumes: one
+// column per list label, sorted by label, with the entity texts as rows.
+// Lists of entities other than the type EntityTypes or DefaultEntityType
+// gives their column, and lists whose label would be read as a type hint,
+// get a "Label:type" header.
+// If WeightSeparator is set, the salience of weighted entities is written
+// after it, as in "golang@0.8".
+func WriteListsCSV(w io.Writer, lists []FeedlyList, config Config) error {
+	sorted := make([]FeedlyList, len(lists))
+	copy(sorted, lists)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Label < sorted[j].Label })
+
+	writer := csv.NewWriter(w)
+	writer.Comma = []rune(config.Delimiter)[0]
+
+	headers := make([]string, len(sorted))
+	rows := 0
+	for i, list := range sorted {
+		// Strip the affixes the sync adds, so that the export syncs back to
+		// the same lists.
+		headers[i] = list.Label
+		if label, ok := strings.CutPrefix(headers[i], config.LabelPrefix); ok {
+			if label, ok = strings.CutSuffix(label, config.LabelSuffix); ok && label != "" {
+				headers[i] = label
+			}
+		}
+		entityType, ok := config.EntityTypes[headers[i]]
+		if !ok {
+			entityType = config.DefaultEntityType
+		}
+		if len(list.Entities) > 0 && list.Entities[0].Type != entityType {
+			headers[i] += ":" + list.Entities[0].Type
+		} else if _, hint := parseColumnHeader(headers[i]); hint != "" {
+			// "Tech:source" of keywords becomes "Tech:source:customKeyword".
+			headers[i] += ":" + entityType
+		}
+		if len(list.Entities) > rows {
+			rows = len(list.Entities)
+		}
+	}
+	if err := writer.Write(headers); err != nil {
+		return fmt.Errorf("error writing CSV headers: %v", err)
+	}
+
+	for row := 0; row < rows; row++ {
+		record := make([]string, len(sorted))
+		for i, list := range sorted {
+			if row < len(list.Entities) {
+				entity := list.Entities[row]
+				record[i] = entity.Text
+				if entity.Salience != 0 && config.WeightSeparator != "" {
+					record[i] += config.WeightSeparator + strconv.FormatFloat(entity.Salience, 'g', -1, 64)
+				}
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("error writing CSV row: %v", err)
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// columnListName returns the Feedly list label and entity type for a CSV
+// column, applying LabelMapping to the name from the header and then adding
+// LabelPrefix and LabelSuffix. As lists are created and matched by this
+// label, the affixes keep lists of different setups apart. The entity type
+// is the one in the header, else the one EntityTypes maps the name to, else
+// DefaultEntityType.
+func columnListName(header string, config Config) (listName, entityType string) {
+	listName, entityType = parseColumnHeader(header)
+	if entityType == "" {
+		entityType = config.EntityTypes[listName]
+	}
+	if entityType == "" {
+		entityType = config.DefaultEntityType
+	}
+	if label, ok := config.LabelMapping[listName]; ok {
+		listName = label
+	}
+	return config.LabelPrefix + listName + config.LabelSuffix, entityType
+}
+
+// defaultListType is the type of the lists created for columns that have
+// no entry in ListTypes.
+const defaultListType = "customTopic"
+
+// knownListTypes are the list types ListTypes accepts.
+var knownListTypes = map[string]bool{
+	"customTopic":   true,
+	"organization":  true,
+	"technology":    true,
+	"threatActor":   true,
+	"malwareFamily": true,
+	"vulnerability": true,
+}
+
+// columnListType returns the type of the lists created for a CSV column.
+func columnListType(header string, config Config) string {
+	name, _ := parseColumnHeader(header)
+	if listType, ok := config.ListTypes[name]; ok {
+		return listType
+	}
+	return defaultListType
+}
+
+// columnListID returns the Feedly list ID that ListIDs assigns to a CSV
+// column, or "" if the column's lists are matched by label.
+func columnListID(header string, config Config) string {
+	name, _ := parseColumnHeader(header)
+	return config.ListIDs[name]
+}
+
+// parseColumnHeader splits a CSV column header into the list name and the
+// entity type of its entries. "Tech:source" yields ("Tech", "source"); a
+// header without a type hint, including one whose suffix is not a known
+// type such as "Project:Alpha", yields the header itself and "".
+func parseColumnHeader(header string) (listName, entityType string) {
+	if match := entityTypeHint.FindStringSubmatch(header); match != nil && knownEntityTypes[match[2]] {
+		return strings.TrimSpace(match[1]), match[2]
+	}
+	return header, ""
+}
@@ -0,0 +1,255 @@
+package feedly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestColumnIteratorNextBatch(t *testing.T) {
+	first := writeFile(t, "first.csv", "Tech,Finance,Sports\ngolang,stocks,\nrust,,tennis\n")
+	second := writeFile(t, "second.csv", "Tech,Health\nzig,yoga\n")
+	config := DefaultConfig()
+
+	columns, err := NewColumnIterator(context.Background(), []string{first, second}, config)
+	if err != nil {
+		t.Fatalf("NewColumnIterator: %v", err)
+	}
+	if got, want := fmt.Sprint(columns.Headers()), "[Finance Health Sports Tech]"; got != want {
+		t.Fatalf("Headers() = %s, want %s", got, want)
+	}
+
+	var batches []string
+	for {
+		batch, err := columns.NextBatch(context.Background(), 3)
+		if err != nil {
+			t.Fatalf("NextBatch: %v", err)
+		}
+		if len(batch) == 0 {
+			break
+		}
+		batches = append(batches, fmt.Sprint(batch))
+	}
+	want := []string{"map[Finance:[stocks] Health:[yoga] Sports:[tennis]]", "map[Tech:[golang rust zig]]"}
+	if fmt.Sprint(batches) != fmt.Sprint(want) {
+		t.Errorf("batches = %q, want %q", batches, want)
+	}
+
+	columns.Reset()
+	all, err := columns.NextBatch(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("NextBatch: %v", err)
+	}
+	if len(all) != 4 {
+		t.Errorf("NextBatch(0) returned %d columns after Reset, want 4", len(all))
+	}
+}
+
+func TestParseColumnHeader(t *testing.T) {
+	tests := []struct {
+		header, listName, entityType string
+	}{
+		{"Tech", "Tech", ""},
+		{"Tech:source", "Tech", "source"},
+		{"Tech :topic", "Tech", "topic"},
+		{"Threats:threatActor", "Threats", "threatActor"},
+		{"Project:Alpha", "Project:Alpha", ""},
+		{"Tech:sources", "Tech:sources", ""},
+		{"Tech:source:customKeyword", "Tech:source", "customKeyword"},
+		{":source", ":source", ""},
+	}
+	for _, test := range tests {
+		listName, entityType := parseColumnHeader(test.header)
+		if listName != test.listName || entityType != test.entityType {
+			t.Errorf("parseColumnHeader(%q) = %q, %q, want %q, %q", test.header, listName, entityType, test.listName, test.entityType)
+		}
+	}
+}
+
+func TestColumnListNameEntityType(t *testing.T) {
+	config := DefaultConfig()
+	config.EntityTypes = map[string]string{"Finance": "topic"}
+	tests := []struct {
+		header, listName, entityType string
+	}{
+		{"Tech", "Tech", defaultEntityType},
+		{"Tech:source", "Tech", "source"},
+		{"Finance", "Finance", "topic"},
+		{"Finance:source", "Finance", "source"},
+		{"Project:Alpha", "Project:Alpha", defaultEntityType},
+	}
+	for _, test := range tests {
+		listName, entityType := columnListName(test.header, config)
+		if listName != test.listName || entityType != test.entityType {
+			t.Errorf("columnListName(%q) = %q, %q, want %q, %q", test.header, listName, entityType, test.listName, test.entityType)
+		}
+	}
+}
+
+func TestWriteListsCSVRoundTrip(t *testing.T) {
+	config := DefaultConfig()
+	lists := []FeedlyList{
+		{Label: "Project:Alpha", Entities: keywords("alpha")},
+		{Label: "Project:source", Entities: keywords("beta")},
+		{Label: "Sources", Entities: []FeedlyEntity{{Type: "source", Text: "feed/1"}}},
+		{Label: "Tech", Entities: keywords("golang")},
+	}
+	var buf strings.Builder
+	if err := WriteListsCSV(&buf, lists, config); err != nil {
+		t.Fatalf("WriteListsCSV: %v", err)
+	}
+
+	csvData, err := ParseCSV(context.Background(), strings.NewReader(buf.String()), config)
+	if err != nil {
+		t.Fatalf("ParseCSV(%q): %v", buf.String(), err)
+	}
+	for _, list := range lists {
+		var found bool
+		for header, entries := range csvData {
+			listName, entityType := columnListName(header, config)
+			if listName != list.Label {
+				continue
+			}
+			found = true
+			if entityType != list.Entities[0].Type || fmt.Sprint(entries) != fmt.Sprint([]string{list.Entities[0].Text}) {
+				t.Errorf("column %q reads back as %s %v, want %s %s", header, entityType, entries, list.Entities[0].Type, list.Entities[0].Text)
+			}
+		}
+		if !found {
+			t.Errorf("list %q has no column in %q", list.Label, buf.String())
+		}
+	}
+}
+
+func TestParseCSVStripsBOM(t *testing.T) {
+	csvData, err := ParseCSV(context.Background(), strings.NewReader("\ufeffTech,Finance\ngolang,stocks\n"), DefaultConfig())
+	if err != nil {
+		t.Fatalf("ParseCSV: %v", err)
+	}
+	if _, ok := csvData["Tech"]; !ok {
+		t.Errorf("columns = %v, want a clean \"Tech\" column", csvData)
+	}
+}
+
+func TestReadCSVDataStripsBOM(t *testing.T) {
+	filename := writeFile(t, "excel.csv", "\ufeffTech,Finance\r\ngolang,stocks\r\n")
+	csvData, err := ReadCSVData(context.Background(), []string{filename}, DefaultConfig())
+	if err != nil {
+		t.Fatalf("ReadCSVData: %v", err)
+	}
+	if got := fmt.Sprint(csvData); got != "map[Finance:[stocks] Tech:[golang]]" {
+		t.Errorf("columns = %s, want Finance and a clean Tech", got)
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	input := "Tech,Finance,Empty\ngolang,stocks,\n,bonds,\ngolang,,\n"
+	csvData, err := ParseCSV(context.Background(), strings.NewReader(input), DefaultConfig())
+	if err != nil {
+		t.Fatalf("ParseCSV: %v", err)
+	}
+	if got, want := fmt.Sprint(csvData), "map[Empty:[] Finance:[stocks bonds] Tech:[golang golang]]"; got != want {
+		t.Errorf("ParseCSV = %s, want %s", got, want)
+	}
+}
+
+func TestPrepareColumns(t *testing.T) {
+	config := DefaultConfig()
+	config.NormalizeKeywords = true
+	config.LowercaseKeywords = true
+	config.MaxRows = 2
+	data := map[string][]string{"Tech": {"  Go  Lang ", "go lang", "rust", "zig"}}
+
+	warnings, dropped, capped := PrepareColumns(data, config)
+	if got, want := fmt.Sprint(data["Tech"]), "[go lang rust]"; got != want {
+		t.Errorf("Tech = %s, want %s", got, want)
+	}
+	if len(warnings) != 1 || dropped != 0 {
+		t.Errorf("got warnings %q and %d dropped, want one warning about the cut-off column", warnings, dropped)
+	}
+	if capped["Tech"] != 1 {
+		t.Errorf("capped = %v, want 1 entry of Tech", capped)
+	}
+}
+
+func TestDuplicateHeaders(t *testing.T) {
+	input := "Tech,Finance,Tech\ngolang,stocks,rust\nrust,,zig\n"
+
+	config := DefaultConfig()
+	config.StrictColumns = true
+	if _, err := ParseCSV(context.Background(), strings.NewReader(input), config); !errors.Is(err, ErrInvalidCSV) {
+		t.Errorf("ParseCSV in strict mode = %v, want ErrInvalidCSV", err)
+	}
+
+	config.StrictColumns = false
+	csvData, err := ParseCSV(context.Background(), strings.NewReader(input), config)
+	if err != nil {
+		t.Fatalf("ParseCSV in lenient mode: %v", err)
+	}
+	PrepareColumns(csvData, config)
+	if got, want := fmt.Sprint(csvData["Tech"]), "[golang rust zig]"; got != want {
+		t.Errorf("Tech = %s, want the merged columns %s", got, want)
+	}
+
+	filename := writeFile(t, "data.csv", input)
+	columns, err := NewColumnIterator(context.Background(), []string{filename}, config)
+	if err != nil {
+		t.Fatalf("NewColumnIterator: %v", err)
+	}
+	batch, err := columns.NextBatch(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("NextBatch: %v", err)
+	}
+	if got, want := fmt.Sprint(batch["Tech"]), "[golang rust zig]"; got != want {
+		t.Errorf("NextBatch Tech = %s, want %s", got, want)
+	}
+}
+
+func TestOverlongKeywords(t *testing.T) {
+	tests := []struct {
+		policy      string
+		want        string
+		wantDropped int
+	}{
+		{overlongDrop, "[short]", 2},
+		{overlongTruncate, "[short overl straß]", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.policy, func(t *testing.T) {
+			config := DefaultConfig()
+			config.MaxKeywordLength = 5
+			config.OnOverlongKeyword = test.policy
+			data := map[string][]string{"Tech": {"short", "overlong", "straßenbahn"}}
+
+			warnings, dropped, _ := PrepareColumns(data, config)
+			if got := fmt.Sprint(data["Tech"]); got != test.want {
+				t.Errorf("Tech = %s, want %s", got, test.want)
+			}
+			if dropped != test.wantDropped || len(warnings) != 1 {
+				t.Errorf("got %d dropped and warnings %q, want %d and one warning", dropped, warnings, test.wantDropped)
+			}
+		})
+	}
+}
+
+func TestTrailingEmptyColumns(t *testing.T) {
+	input := "Tech,Finance,,\ngolang,stocks,,\nrust,,,\n"
+	csvData, err := ParseCSV(context.Background(), strings.NewReader(input), DefaultConfig())
+	if err != nil {
+		t.Fatalf("ParseCSV: %v", err)
+	}
+	if got, want := fmt.Sprint(csvData), "map[Finance:[stocks] Tech:[golang rust]]"; got != want {
+		t.Errorf("ParseCSV = %s, want %s", got, want)
+	}
+
+	filename := writeFile(t, "export.csv", input)
+	columns, err := NewColumnIterator(context.Background(), []string{filename}, DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewColumnIterator: %v", err)
+	}
+	if got, want := fmt.Sprint(columns.Headers()), "[Finance Tech]"; got != want {
+		t.Errorf("Headers() = %s, want %s", got, want)
+	}
+}
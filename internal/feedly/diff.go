@@ -0,0 +1,71 @@
+package feedly
+
+import (
+	"sort"
+)
+
+// ListDiff compares the keywords of a CSV column with the Feedly list it is
+// synced to, including that list's overflow lists. Added holds the keywords
+// that are not in Feedly yet and Existing those that are. Removed holds the
+// keywords a replace sync would take out of the lists; it is always empty in
+// append mode.
+type ListDiff struct {
+	Column   string   `json:"column"`
+	List     string   `json:"list"`
+	Added    []string `json:"added"`
+	Existing []string `json:"existing"`
+	Removed  []string `json:"removed"`
+}
+
+// ComputeDiff works out, for every non-empty CSV column, which keywords a
+// sync would add, keep and remove, without sending anything to Feedly. The
+// lists of a column are found the same way the sync finds them, and the
+// result is sorted by column. With OnlyCreate, columns whose list already
+// exists are left out, as the sync skips them.
+func ComputeDiff(csvData map[string][]string, feedlyData []FeedlyList, config Config) []ListDiff {
+	diffs := make([]ListDiff, 0, len(csvData))
+	for header, entries := range csvData {
+		if len(entries) == 0 {
+			continue
+		}
+		listName, _ := columnListName(header, config)
+
+		lists := columnLists(header, listName, feedlyData, config)
+		if config.OnlyCreate && len(lists) > 0 {
+			continue
+		}
+
+		inFeedly := make(map[string]bool)
+		var current []string
+		for _, list := range lists {
+			for _, entity := range list.Entities {
+				if !inFeedly[entity.Text] {
+					inFeedly[entity.Text] = true
+					current = append(current, entity.Text)
+				}
+			}
+		}
+
+		diff := ListDiff{Column: header, List: listName, Added: []string{}, Existing: []string{}, Removed: []string{}}
+		inCSV := make(map[string]bool, len(entries))
+		for _, entry := range entries {
+			text, _ := splitWeight(entry, config)
+			inCSV[text] = true
+			if inFeedly[text] {
+				diff.Existing = append(diff.Existing, text)
+			} else {
+				diff.Added = append(diff.Added, text)
+			}
+		}
+		if config.SyncMode == syncModeReplace {
+			for _, text := range current {
+				if !inCSV[text] {
+					diff.Removed = append(diff.Removed, text)
+				}
+			}
+		}
+		diffs = append(diffs, diff)
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Column < diffs[j].Column })
+	return diffs
+}
@@ -0,0 +1,58 @@
+// Package feedly syncs keyword columns from CSV files to Feedly entity lists.
+// It holds the logic shared by the CLI and the GUI.
+package feedly
+
+import (
+	"errors"
+	"fmt"
+)
+
+// FeedlyEntity is a single entry of a list. Salience weights the entity
+// when Feedly matches articles; it is left out for plain keywords.
+type FeedlyEntity struct {
+	Type     string  `json:"type"`
+	Text     string  `json:"text"`
+	Salience float64 `json:"salience,omitempty"`
+}
+
+type FeedlyList struct {
+	ID       string         `json:"id,omitempty"`
+	Label    string         `json:"label"`
+	Type     string         `json:"type"`
+	Entities []FeedlyEntity `json:"entities"`
+}
+
+// Errors that callers can tell apart with errors.Is. The errors returned by
+// this package wrap one of them where it applies.
+var (
+	ErrConfigMissing     = errors.New("config file not found")
+	ErrInvalidCSV        = errors.New("invalid CSV")
+	ErrInvalidJSONL      = errors.New("invalid JSON Lines input")
+	ErrNoDataRows        = errors.New("no data rows found, nothing to sync")
+	ErrAuthFailed        = errors.New("authentication failed")
+	ErrRateLimited       = errors.New("rate limited by Feedly")
+	ErrFeedlyUnavailable = errors.New("Feedly is unavailable")
+	ErrTooManyLists      = errors.New("too many new lists")
+	ErrOrphanColumns     = errors.New("columns without a list")
+	ErrStopped           = errors.New("sync stopped before all lists were sent")
+)
+
+// AuthError is returned when Feedly rejects the API key with 401 or 403.
+// Detail holds Feedly's explanation from the response body, if any.
+type AuthError struct {
+	StatusCode int
+	Detail     string
+}
+
+func (e *AuthError) Error() string {
+	message := fmt.Sprintf("Feedly rejected the API key (status %d): check the api_key in your config, it may be wrong or expired", e.StatusCode)
+	if e.Detail != "" {
+		message += fmt.Sprintf(" (Feedly says: %s)", e.Detail)
+	}
+	return message
+}
+
+// Unwrap makes errors.Is(err, ErrAuthFailed) true for an AuthError.
+func (e *AuthError) Unwrap() error {
+	return ErrAuthFailed
+}
@@ -0,0 +1,301 @@
+package feedly
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	SetLogLevel("error")
+	os.Exit(m.Run())
+}
+
+// fakeRequest is a request received by fakeFeedly.
+type fakeRequest struct {
+	Method string
+	Path   string
+	Header http.Header
+	List   FeedlyList
+}
+
+// fakeFeedly mimics the Feedly entity lists endpoint: GET returns the lists,
+// POST creates one, PUT replaces the entities of one and DELETE removes
+// one. status, if set, picks the status of a mutation instead. peak is the
+// largest number of requests that were served at the same time.
+type fakeFeedly struct {
+	*httptest.Server
+	t *testing.T
+
+	mu       sync.Mutex
+	lists    []FeedlyList
+	requests []fakeRequest
+	nextID   int
+	status   func(r *http.Request, list FeedlyList) int
+	delay    time.Duration
+	inFlight int
+	peak     int
+}
+
+// newFakeFeedly starts a fakeFeedly holding lists. It is closed when the test
+// ends.
+func newFakeFeedly(t *testing.T, lists ...FeedlyList) *fakeFeedly {
+	t.Helper()
+	f := &fakeFeedly{t: t, lists: lists}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeFeedly) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.inFlight++
+	f.peak = max(f.peak, f.inFlight)
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.inFlight--
+		f.mu.Unlock()
+	}()
+	if f.delay > 0 {
+		time.Sleep(f.delay)
+	}
+	var list FeedlyList
+	if r.Body != nil {
+		body, _ := io.ReadAll(r.Body)
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &list); err != nil {
+				f.t.Errorf("%s %s: invalid body %q: %v", r.Method, r.URL, body, err)
+			}
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Method != "GET" {
+		f.requests = append(f.requests, fakeRequest{Method: r.Method, Path: r.URL.Path, Header: r.Header.Clone(), List: list})
+	}
+	if f.status != nil && r.Method != "GET" {
+		if status := f.status(r, list); status != 0 {
+			w.WriteHeader(status)
+			return
+		}
+	}
+
+	switch r.Method {
+	case "GET":
+		json.NewEncoder(w).Encode(feedlyPage{Items: f.lists})
+	case "POST":
+		f.nextID++
+		list.ID = fmt.Sprintf("list-%d", f.nextID)
+		f.lists = append(f.lists, list)
+		json.NewEncoder(w).Encode(FeedlyList{ID: list.ID})
+	case "PUT":
+		for i := range f.lists {
+			if f.lists[i].ID == list.ID {
+				f.lists[i].Entities = list.Entities
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	case "DELETE":
+		id := path.Base(r.URL.Path)
+		for i := range f.lists {
+			if f.lists[i].ID == id {
+				f.lists = append(f.lists[:i], f.lists[i+1:]...)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// sent returns the mutations received so far.
+func (f *fakeFeedly) sent() []fakeRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeRequest(nil), f.requests...)
+}
+
+// methods returns the methods of the mutations received so far.
+func (f *fakeFeedly) methods() []string {
+	var methods []string
+	for _, req := range f.sent() {
+		methods = append(methods, req.Method)
+	}
+	return methods
+}
+
+// list returns the list labelled label, failing the test if there is none.
+func (f *fakeFeedly) list(label string) FeedlyList {
+	f.t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, list := range f.lists {
+		if list.Label == label {
+			return list
+		}
+	}
+	f.t.Fatalf("no list %q in Feedly", label)
+	return FeedlyList{}
+}
+
+// labels returns the labels of all lists, sorted.
+func (f *fakeFeedly) labels() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var labels []string
+	for _, list := range f.lists {
+		labels = append(labels, list.Label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// testConfig returns a valid config for the fake server at url that sends
+// requests without waiting and never retries.
+func testConfig(url string) Config {
+	config := DefaultConfig()
+	config.UploadURL = url
+	config.APIKey = "test-key"
+	config.RequestsPerSecond = 1000
+	config.MaxRetries = 0
+	config.RetryBaseDelay = Duration(time.Millisecond)
+	return config
+}
+
+// syncFake fetches the lists of f and syncs csvData to it.
+func syncFake(t *testing.T, f *fakeFeedly, csvData map[string][]string, config Config) (SyncResult, error) {
+	t.Helper()
+	feedlyData, err := FetchFeedlyData(context.Background(), f.Client(), config)
+	if err != nil {
+		t.Fatalf("FetchFeedlyData: %v", err)
+	}
+	return SyncToFeedly(context.Background(), f.Client(), csvData, feedlyData, config, nil)
+}
+
+// keywords returns the entities of a list with the given texts, as the sync
+// creates them for a plain column.
+func keywords(texts ...string) []FeedlyEntity {
+	entities := make([]FeedlyEntity, len(texts))
+	for i, text := range texts {
+		entities[i] = FeedlyEntity{Type: defaultEntityType, Text: text}
+	}
+	return entities
+}
+
+// texts returns the texts of entities.
+func texts(entities []FeedlyEntity) string {
+	var texts []string
+	for _, entity := range entities {
+		texts = append(texts, entity.Text)
+	}
+	return strings.Join(texts, ",")
+}
+
+func TestSyncCreatesAndUpdatesLists(t *testing.T) {
+	f := newFakeFeedly(t, FeedlyList{ID: "tech", Label: "Tech", Type: defaultListType, Entities: keywords("golang")})
+	config := testConfig(f.URL)
+	config.RunID = "run-1"
+
+	result, err := syncFake(t, f, map[string][]string{"Tech": {"golang", "rust"}, "Finance": {"stocks"}}, config)
+	if err != nil {
+		t.Fatalf("SyncToFeedly: %v", err)
+	}
+	if result.ListsCreated != 1 || result.ListsUpdated != 1 || result.EntitiesAdded != 2 {
+		t.Errorf("got %d created, %d updated, %d added; want 1, 1, 2", result.ListsCreated, result.ListsUpdated, result.EntitiesAdded)
+	}
+
+	for _, req := range f.sent() {
+		if got := req.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("%s: Authorization = %q", req.Method, got)
+		}
+		if got := req.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("%s: Content-Type = %q", req.Method, got)
+		}
+		if got := req.Header.Get("X-Request-Id"); got != "run-1" {
+			t.Errorf("%s: X-Request-Id = %q", req.Method, got)
+		}
+		switch req.Method {
+		case "POST":
+			if req.List.Label != "Finance" || req.List.Type != defaultListType || texts(req.List.Entities) != "stocks" {
+				t.Errorf("POST body = %+v", req.List)
+			}
+		case "PUT":
+			if req.List.ID != "tech" || texts(req.List.Entities) != "golang,rust" {
+				t.Errorf("PUT body = %+v", req.List)
+			}
+		default:
+			t.Errorf("unexpected %s request", req.Method)
+		}
+	}
+	if got := texts(f.list("Tech").Entities); got != "golang,rust" {
+		t.Errorf("Tech holds %s, want golang,rust", got)
+	}
+}
+
+func TestFetchFeedlyDataFollowsContinuation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("details") != "true" {
+			t.Errorf("missing details=true in %s", r.URL)
+		}
+		switch r.URL.Query().Get("continuation") {
+		case "":
+			json.NewEncoder(w).Encode(feedlyPage{Items: []FeedlyList{{ID: "1", Label: "A"}}, Continuation: "next"})
+		case "next":
+			json.NewEncoder(w).Encode(feedlyPage{Items: []FeedlyList{{ID: "2", Label: "B"}}})
+		}
+	}))
+	defer server.Close()
+
+	lists, err := FetchFeedlyData(context.Background(), server.Client(), testConfig(server.URL))
+	if err != nil {
+		t.Fatalf("FetchFeedlyData: %v", err)
+	}
+	if len(lists) != 2 || lists[0].Label != "A" || lists[1].Label != "B" {
+		t.Errorf("got %+v, want lists A and B", lists)
+	}
+}
+
+func TestSyncDryRunSendsNothing(t *testing.T) {
+	f := newFakeFeedly(t)
+	config := testConfig(f.URL)
+	config.DryRun = true
+
+	result, err := syncFake(t, f, map[string][]string{"Tech": {"golang"}}, config)
+	if err != nil {
+		t.Fatalf("SyncToFeedly: %v", err)
+	}
+	if len(f.sent()) != 0 {
+		t.Errorf("dry run sent %v", f.methods())
+	}
+	if len(result.Plan) != 1 || result.Plan[0] != `POST "Tech": golang` {
+		t.Errorf("Plan = %q", result.Plan)
+	}
+}
+
+// writeFile writes content to a file named name in a temporary directory and
+// returns its path.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
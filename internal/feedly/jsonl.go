@@ -0,0 +1,101 @@
+package feedly
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Input formats for InputFormat.
+const (
+	inputFormatCSV   = "csv"
+	inputFormatJSONL = "jsonl"
+)
+
+// maxJSONLLine is the longest line, in bytes, that JSON Lines input may have.
+const maxJSONLLine = 1 << 20
+
+// jsonlRecord is one line of JSON Lines input: a keyword and the list it
+// belongs to. The list takes the place of a CSV header, so type hints such
+// as "Tech:source" and label_mapping apply to it as well.
+type jsonlRecord struct {
+	List    string `json:"list"`
+	Keyword string `json:"keyword"`
+}
+
+// ParseJSONL reads JSON Lines input, one object such as
+// {"list":"Tech","keyword":"golang"} per line, into the same map from list
+// to entries that ParseCSV returns for a CSV file. Blank lines are skipped,
+// and so are objects without a list, with a debug line. Input without any
+// object is an error.
+func ParseJSONL(ctx context.Context, r io.Reader, config Config) (map[string][]string, error) {
+	return parseColumns(ctx, r, config, scanJSONL)
+}
+
+// ParseInput is ParseCSV or ParseJSONL, depending on InputFormat.
+func ParseInput(ctx context.Context, r io.Reader, config Config) (map[string][]string, error) {
+	return parseColumns(ctx, r, config, inputScanner(config))
+}
+
+// scanFunc reads input in one of the input formats and calls visit for every
+// data row, as scanCSV does.
+type scanFunc func(ctx context.Context, r io.Reader, config Config, visit func(headers, record []string, row int) error) ([]string, int, error)
+
+// inputScanner returns the scanFunc for InputFormat.
+func inputScanner(config Config) scanFunc {
+	if strings.EqualFold(config.InputFormat, inputFormatJSONL) {
+		return scanJSONL
+	}
+	return scanCSV
+}
+
+// scanJSONL is scanCSV for JSON Lines input. Every object is passed to visit
+// as a row with the list as its only header and the keyword as its only
+// field, numbered by its line. The returned headers are the lists in the
+// order they first appear.
+func scanJSONL(ctx context.Context, r io.Reader, config Config, visit func(headers, record []string, row int) error) (headers []string, rows int, err error) {
+	scanner := bufio.NewScanner(decodeInput(r, config))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxJSONLLine)
+	seen := make(map[string]bool)
+	lines := 0
+	for line := 1; scanner.Scan(); line++ {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		lines++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var record jsonlRecord
+		if err := json.Unmarshal([]byte(text), &record); err != nil {
+			return nil, 0, fmt.Errorf("%w: error decoding line %d: %v", ErrInvalidJSONL, line, err)
+		}
+		if err := checkUTF8([]string{record.List, record.Keyword}, line); err != nil {
+			return nil, 0, err
+		}
+		if blankHeader(record.List) {
+			LogDebugf("Skipping line %d, it has no list", line)
+			continue
+		}
+		if !seen[record.List] {
+			seen[record.List] = true
+			headers = append(headers, record.List)
+		}
+		rows++
+		if err := visit([]string{record.List}, []string{record.Keyword}, line); err != nil {
+			return nil, 0, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, fmt.Errorf("%w: error reading input: %v", ErrInvalidJSONL, err)
+	}
+	if lines == 0 {
+		return nil, 0, fmt.Errorf("%w: input file is empty", ErrInvalidJSONL)
+	}
+	return headers, rows, nil
+}
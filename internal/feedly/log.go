@@ -0,0 +1,38 @@
+package feedly
+
+import (
+	"log"
+)
+
+const (
+	levelDebug = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevels = map[string]int{
+	"debug": levelDebug,
+	"info":  levelInfo,
+	"warn":  levelWarn,
+	"error": levelError,
+}
+
+// currentLogLevel is the lowest level that is still written to the log.
+var currentLogLevel = levelInfo
+
+// SetLogLevel sets the minimum level written by the Log*f helpers.
+func SetLogLevel(name string) {
+	currentLogLevel = logLevels[name]
+}
+
+func logf(level int, format string, args ...interface{}) {
+	if level >= currentLogLevel {
+		log.Printf(format, args...)
+	}
+}
+
+func LogDebugf(format string, args ...interface{}) { logf(levelDebug, format, args...) }
+func LogInfof(format string, args ...interface{})  { logf(levelInfo, format, args...) }
+func LogWarnf(format string, args ...interface{})  { logf(levelWarn, format, args...) }
+func LogErrorf(format string, args ...interface{}) { logf(levelError, format, args...) }
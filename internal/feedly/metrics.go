@@ -0,0 +1,74 @@
+package feedly
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// lastSuccessMetric is kept across failed runs, so that an alert can fire
+// when it grows too old.
+const lastSuccessMetric = "feedly_sync_last_success_timestamp_seconds"
+
+// WriteMetrics writes the result of a sync run to MetricsPath, if it is set,
+// in the Prometheus text format read by the node_exporter textfile
+// collector. The file is replaced as a whole through a temporary file, so
+// the collector never sees a partial write. Dry runs change nothing and
+// write no metrics. Like the report, failing to write them is only logged.
+func WriteMetrics(result SyncResult, syncErr error, config Config) {
+	if config.MetricsPath == "" || config.DryRun {
+		return
+	}
+
+	errorCount := len(result.Errors)
+	if syncErr != nil && errorCount == 0 {
+		errorCount = 1
+	}
+	lastSuccess := previousLastSuccess(config.MetricsPath)
+	if syncErr == nil {
+		lastSuccess = fmt.Sprint(time.Now().Unix())
+	}
+
+	var metrics bytes.Buffer
+	writeMetric := func(name, help string, value interface{}) {
+		fmt.Fprintf(&metrics, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, value)
+	}
+	writeMetric("feedly_sync_lists_created", "Lists created by the last sync run.", result.ListsCreated)
+	writeMetric("feedly_sync_lists_updated", "Lists updated by the last sync run.", result.ListsUpdated)
+	writeMetric("feedly_sync_lists_deleted", "Lists deleted by the last sync run.", result.ListsDeleted)
+	writeMetric("feedly_sync_entities_added", "Entities added by the last sync run.", result.EntitiesAdded)
+	writeMetric("feedly_sync_errors_total", "Failed lists of the last sync run.", errorCount)
+	if lastSuccess != "" {
+		writeMetric(lastSuccessMetric, "Unix time of the last sync run without errors.", lastSuccess)
+	}
+
+	tmpPath := config.MetricsPath + ".tmp"
+	err := os.WriteFile(tmpPath, metrics.Bytes(), 0o644)
+	if err == nil {
+		err = os.Rename(tmpPath, config.MetricsPath)
+	}
+	if err != nil {
+		LogWarnf("Failed to write metrics to %s: %v", config.MetricsPath, err)
+	}
+}
+
+// previousLastSuccess returns the value of lastSuccessMetric in the metrics
+// file at path, or "" if there is none.
+func previousLastSuccess(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), lastSuccessMetric+" "); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,90 @@
+package feedly
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxLabelLength is the longest list label, in characters, that Feedly
+// accepts.
+const maxLabelLength = 255
+
+// Statuses of a ColumnCheck.
+const (
+	CheckOK           = "ok"
+	CheckWillCreate   = "will-create"
+	CheckLabelTooLong = "label-too-long"
+	CheckInvalidLabel = "invalid"
+)
+
+// ColumnCheck is the finding of PreflightCheck for one CSV column. Status is
+// CheckOK if the column's list exists, CheckWillCreate if it can be created
+// and CheckLabelTooLong or CheckInvalidLabel if Feedly would reject the
+// label; Detail then says why.
+type ColumnCheck struct {
+	Column string `json:"column"`
+	List   string `json:"list"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Failed reports whether the column cannot be synced as it is.
+func (c ColumnCheck) Failed() bool {
+	return c.Status == CheckLabelTooLong || c.Status == CheckInvalidLabel
+}
+
+// PreflightCheck verifies, without sending anything to Feedly, that every
+// non-empty CSV column either has a list in Feedly or gets one that Feedly
+// will accept. The labels of the overflow lists a column would need are
+// checked as well. The result is sorted by column.
+func PreflightCheck(csvData map[string][]string, feedlyData []FeedlyList, config Config) []ColumnCheck {
+	checks := make([]ColumnCheck, 0, len(csvData))
+	for header, entries := range csvData {
+		if len(entries) == 0 {
+			continue
+		}
+		listName, _ := columnListName(header, config)
+		check := ColumnCheck{Column: header, List: listName, Status: CheckOK}
+
+		var labels []string
+		if len(columnLists(header, listName, feedlyData, config)) == 0 {
+			check.Status = CheckWillCreate
+			labels = append(labels, listName)
+		}
+		// A column with more than MaxEntitiesPerList entries spills over
+		// into overflow lists; the last one has the longest label.
+		if len(entries) > config.MaxEntitiesPerList {
+			lists := (len(entries) + config.MaxEntitiesPerList - 1) / config.MaxEntitiesPerList
+			labels = append(labels, overflowLabel(listName, lists, config.OverflowLabelFormat))
+		}
+		for _, label := range labels {
+			if status, detail := checkLabel(label); status != "" {
+				check.Status, check.Detail = status, detail
+				break
+			}
+		}
+		checks = append(checks, check)
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Column < checks[j].Column })
+	return checks
+}
+
+// checkLabel returns the status and the reason why Feedly would reject the
+// label of a new list, or "" if the label is fine.
+func checkLabel(label string) (status, detail string) {
+	if strings.TrimSpace(label) == "" {
+		return CheckInvalidLabel, "the label is empty"
+	}
+	if n := utf8.RuneCountInString(label); n > maxLabelLength {
+		return CheckLabelTooLong, fmt.Sprintf("label %q has %d characters, Feedly allows at most %d", label, n, maxLabelLength)
+	}
+	for _, r := range label {
+		if r == utf8.RuneError || unicode.IsControl(r) {
+			return CheckInvalidLabel, fmt.Sprintf("label %q contains the invalid character %U", label, r)
+		}
+	}
+	return "", ""
+}
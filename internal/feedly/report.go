@@ -0,0 +1,43 @@
+package feedly
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// syncReport is the line appended to ReportPath for every sync run.
+type syncReport struct {
+	Time   time.Time `json:"time"`
+	DryRun bool      `json:"dry_run"`
+	Error  string    `json:"error,omitempty"`
+	SyncResult
+}
+
+// AppendReport appends the result of a sync run as one JSON line to
+// ReportPath, if it is set. The report is only an audit trail, so failing
+// to write it is logged rather than returned.
+func AppendReport(result SyncResult, syncErr error, config Config) {
+	if config.ReportPath == "" {
+		return
+	}
+
+	report := syncReport{Time: time.Now(), DryRun: config.DryRun, SyncResult: result}
+	if syncErr != nil {
+		report.Error = syncErr.Error()
+	}
+	line, err := json.Marshal(report)
+	if err == nil {
+		var file *os.File
+		file, err = os.OpenFile(config.ReportPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err == nil {
+			_, err = file.Write(append(line, '\n'))
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	if err != nil {
+		LogWarnf("Failed to write sync report to %s: %v", config.ReportPath, err)
+	}
+}
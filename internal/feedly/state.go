@@ -0,0 +1,99 @@
+package feedly
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// syncState is stored in StateFile between runs. Columns maps the stateKey
+// of each column to the hash of the entries it had when it was last synced.
+// Entries written by earlier versions, keyed by the bare header, never match
+// and are left alone, so those columns are synced once more.
+type syncState struct {
+	LastSync time.Time         `json:"last_sync"`
+	Columns  map[string]string `json:"columns"`
+}
+
+// loadState reads the sync state from path. A missing file is an empty
+// state.
+func loadState(path string) (syncState, error) {
+	state := syncState{Columns: make(map[string]string)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("error reading state file: %v", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("error decoding state file: %v", err)
+	}
+	if state.Columns == nil {
+		state.Columns = make(map[string]string)
+	}
+	return state, nil
+}
+
+// stateKey identifies a column in the state: the account, by UploadURL and
+// a hash of the API key, the label of the column's list and the header.
+// Profiles or configs for different accounts, or with different label
+// affixes, can therefore share one StateFile without skipping each other's
+// columns. The API key itself is never written to the file.
+func stateKey(header string, config Config) string {
+	listName, _ := columnListName(header, config)
+	key := sha256.Sum256([]byte(config.APIKey))
+	return fmt.Sprintf("%s [%s] %s <- %s", config.UploadURL, hex.EncodeToString(key[:6]), listName, header)
+}
+
+// skipUnchanged returns csvData without the columns whose hash matches the
+// one recorded in state and marks them as unchanged in the result.
+func skipUnchanged(csvData map[string][]string, state syncState, config Config, result *SyncResult) map[string][]string {
+	changed := make(map[string][]string, len(csvData))
+	for header, entries := range csvData {
+		if hash, ok := state.Columns[stateKey(header, config)]; ok && hash == columnHash(entries) {
+			LogInfof("Skipping column %q, it has not changed since %s", header, state.LastSync.Format(time.RFC3339))
+			for i := range result.Columns {
+				if result.Columns[i].Name == header {
+					result.Columns[i].Unchanged = true
+				}
+			}
+			continue
+		}
+		changed[header] = entries
+	}
+	return changed
+}
+
+// updateState records the hash of every synced column that had no failed
+// request and writes the state to StateFile. The state only saves
+// requests, so failing to write it is logged rather than returned.
+func updateState(state syncState, csvData map[string][]string, failedColumns map[string]bool, config Config) {
+	for header, entries := range csvData {
+		if !failedColumns[header] {
+			state.Columns[stateKey(header, config)] = columnHash(entries)
+		}
+	}
+	state.LastSync = time.Now()
+
+	data, err := json.MarshalIndent(state, "", "    ")
+	if err == nil {
+		err = os.WriteFile(config.StateFile, data, 0o644)
+	}
+	if err != nil {
+		LogWarnf("Failed to write state file %s: %v", config.StateFile, err)
+	}
+}
+
+// columnHash returns a SHA-256 hash of the entries of a column.
+func columnHash(entries []string) string {
+	hash := sha256.New()
+	for _, entry := range entries {
+		hash.Write([]byte(entry))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
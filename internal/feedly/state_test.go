@@ -0,0 +1,78 @@
+package feedly
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSyncSkipsUnchangedColumns(t *testing.T) {
+	f := newFakeFeedly(t)
+	config := testConfig(f.URL)
+	config.StateFile = filepath.Join(t.TempDir(), "state.json")
+
+	if _, err := syncFake(t, f, map[string][]string{"Tech": {"golang"}}, config); err != nil {
+		t.Fatalf("first SyncToFeedly: %v", err)
+	}
+	result, err := syncFake(t, f, map[string][]string{"Tech": {"golang"}, "Finance": {"stocks"}}, config)
+	if err != nil {
+		t.Fatalf("second SyncToFeedly: %v", err)
+	}
+	if got := fmt.Sprint(f.methods()); got != "[POST POST]" {
+		t.Errorf("requests = %s, want one POST per run", got)
+	}
+	for _, column := range result.Columns {
+		if column.Unchanged != (column.Name == "Tech") {
+			t.Errorf("column %q: Unchanged = %v", column.Name, column.Unchanged)
+		}
+	}
+
+	config.Force = true
+	if _, err := syncFake(t, f, map[string][]string{"Tech": {"rust"}}, config); err != nil {
+		t.Fatalf("forced SyncToFeedly: %v", err)
+	}
+	if got := texts(f.list("Tech").Entities); got != "golang,rust" {
+		t.Errorf("Tech holds %s, want golang,rust", got)
+	}
+}
+
+func TestStateIsKeptPerAccount(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	csvData := map[string][]string{"Tech": {"golang"}}
+
+	// Two profiles of the same Feedly endpoint with different keys, then
+	// the same account with a label prefix, all sharing one state file.
+	f := newFakeFeedly(t)
+	work := testConfig(f.URL)
+	work.StateFile = stateFile
+	work.APIKey = "work-key"
+	home := work
+	home.APIKey = "home-key"
+	dev := home
+	dev.LabelPrefix = "[DEV] "
+
+	for i, config := range []Config{work, home, dev, work} {
+		result, err := syncFake(t, f, csvData, config)
+		if err != nil {
+			t.Fatalf("SyncToFeedly: %v", err)
+		}
+		// Only the last run repeats an account and label.
+		if unchanged := result.Columns[0].Unchanged; unchanged != (i == 3) {
+			t.Errorf("run %d: Unchanged = %v", i+1, unchanged)
+		}
+	}
+
+	state, err := loadState(stateFile)
+	if err != nil {
+		t.Fatalf("loadState: %v", err)
+	}
+	if len(state.Columns) != 3 {
+		t.Errorf("state holds %d columns, want 3: %v", len(state.Columns), state.Columns)
+	}
+	for key := range state.Columns {
+		if key == "Tech" || strings.Contains(key, "home-key") || strings.Contains(key, "work-key") {
+			t.Errorf("state key %q is the bare header or holds the API key", key)
+		}
+	}
+}
@@ -0,0 +1,1172 @@
+package feedly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// SyncResult summarizes a sync run. EntitiesSkipped counts the entities
+// that were not delivered because the request for their list failed, and
+// KeywordsDropped the keywords left out because they were too long.
+// Orphans are the columns whose keywords went nowhere, as none of their
+// lists existed and none could be created.
+// RunID is the RunID of the config the run was started with.
+type SyncResult struct {
+	RunID           string          `json:"run_id,omitempty"`
+	ListsCreated    int             `json:"lists_created"`
+	ListsUpdated    int             `json:"lists_updated"`
+	ListsDeleted    int             `json:"lists_deleted"`
+	EntitiesAdded   int             `json:"entities_added"`
+	EntitiesSkipped int             `json:"entities_skipped"`
+	Errors          []ListError     `json:"errors"`
+	Plan            []string        `json:"plan,omitempty"`
+	CreatedLists    []CreatedList   `json:"created_lists,omitempty"`
+	Warnings        []string        `json:"warnings,omitempty"`
+	KeywordsDropped int             `json:"keywords_dropped"`
+	Columns         []ColumnCount   `json:"columns"`
+	Lists           []ListCount     `json:"lists,omitempty"`
+	Orphans         []string        `json:"orphans,omitempty"`
+	BudgetExceeded  bool            `json:"budget_exceeded,omitempty"`
+	SharedKeywords  []SharedKeyword `json:"shared_keywords,omitempty"`
+}
+
+// ColumnCount reports how many keywords were read from a CSV column and how
+// many of them were uploaded. Empty columns are skipped.
+type ColumnCount struct {
+	Name      string `json:"name"`
+	Keywords  int    `json:"keywords"`
+	Uploaded  int    `json:"uploaded"`
+	Skipped   bool   `json:"skipped"`
+	Unchanged bool   `json:"unchanged"`
+}
+
+// ListCount is the number of entities of one list of a CSV column before
+// and after the sync, or after it would have run in dry run mode. A list
+// whose request failed keeps its count. Skipped is the number of the
+// column's entries that were cut off by MaxRows; it is reported on the
+// column's last list, where they would have gone.
+type ListCount struct {
+	Label   string `json:"label"`
+	Column  string `json:"column"`
+	Before  int    `json:"before"`
+	After   int    `json:"after"`
+	Skipped int    `json:"skipped"`
+}
+
+// countLists returns a ListCount for every list of the columns in csvData,
+// the existing ones as well as those the jobs create, assuming that every
+// job succeeds.
+func countLists(csvData map[string][]string, feedlyData []FeedlyList, jobs []listJob, config Config) []ListCount {
+	headers := make([]string, 0, len(csvData))
+	for header, entries := range csvData {
+		if len(entries) > 0 {
+			headers = append(headers, header)
+		}
+	}
+	sort.Strings(headers)
+
+	var counts []ListCount
+	for _, header := range headers {
+		listName, _ := columnListName(header, config)
+		for _, list := range columnLists(header, listName, feedlyData, config) {
+			count := ListCount{Label: list.Label, Column: header, Before: len(list.Entities), After: len(list.Entities)}
+			for _, job := range jobs {
+				if job.Method == "PUT" && job.List.ID == list.ID {
+					count.After = job.Before + job.Entities
+					if config.SyncMode == syncModeReplace {
+						count.After = job.Entities
+					}
+				}
+			}
+			counts = append(counts, count)
+		}
+		for _, job := range jobs {
+			if job.Method == "POST" && job.Column == header {
+				counts = append(counts, ListCount{Label: job.List.Label, Column: header, After: job.Entities})
+			}
+		}
+	}
+	return counts
+}
+
+// failList resets the count of a list whose request failed to the count it
+// had before.
+func (r *SyncResult) failList(label string) {
+	for i := range r.Lists {
+		if r.Lists[i].Label == label {
+			r.Lists[i].After = r.Lists[i].Before
+		}
+	}
+}
+
+// capColumn records the entries of a column that were cut off by MaxRows
+// on the column's last list.
+func (r *SyncResult) capColumn(header string, capped int) {
+	for i := len(r.Lists) - 1; i >= 0; i-- {
+		if r.Lists[i].Column == header {
+			r.Lists[i].Skipped = capped
+			return
+		}
+	}
+}
+
+// CapColumns records the entries cut off by MaxRows, as returned by
+// PrepareColumns, for a result of SyncToFeedly; SyncColumns records them
+// itself.
+func (r *SyncResult) CapColumns(capped map[string]int) {
+	for header, n := range capped {
+		r.capColumn(header, n)
+	}
+}
+
+// CreatedList identifies a list that was created by the sync.
+type CreatedList struct {
+	Label string `json:"label"`
+	ID    string `json:"id"`
+}
+
+// ListError records why the request for a single list failed.
+type ListError struct {
+	Label string `json:"label"`
+	Error string `json:"error"`
+}
+
+// record counts a request that was sent successfully.
+func (r *SyncResult) record(job listJob) {
+	switch job.Method {
+	case "POST":
+		r.ListsCreated++
+	case "DELETE":
+		r.ListsDeleted++
+	default:
+		r.ListsUpdated++
+	}
+	r.EntitiesAdded += job.Added
+	for i := range r.Columns {
+		if r.Columns[i].Name == job.Column {
+			r.Columns[i].Uploaded += job.Entities
+		}
+	}
+}
+
+// countColumns returns a ColumnCount for every CSV column, sorted by name.
+func countColumns(csvData map[string][]string) []ColumnCount {
+	columns := make([]ColumnCount, 0, len(csvData))
+	for header, entries := range csvData {
+		columns = append(columns, ColumnCount{Name: header, Keywords: len(entries), Skipped: len(entries) == 0})
+	}
+	sort.Slice(columns, func(i, j int) bool { return columns[i].Name < columns[j].Name })
+	return columns
+}
+
+func (r *SyncResult) addError(label string, skipped int, err error) {
+	r.Errors = append(r.Errors, ListError{Label: label, Error: err.Error()})
+	r.EntitiesSkipped += skipped
+}
+
+// stopKey is the context key of the channel set by WithStop.
+type stopKey struct{}
+
+// WithStop returns a copy of ctx that asks a sync to stop gracefully once
+// stop is closed: the lists that are being sent are completed, but no
+// further list is started and nothing is pruned, and the sync returns
+// ErrStopped with what was done so far in its result. Cancelling ctx itself
+// still aborts the requests that are running.
+func WithStop(ctx context.Context, stop <-chan struct{}) context.Context {
+	return context.WithValue(ctx, stopKey{}, stop)
+}
+
+// budgetKey is the context key of the budget set by WithBudget.
+type budgetKey struct{}
+
+// budget records whether the time of WithBudget ran out.
+type budget struct {
+	limit    time.Duration
+	exceeded atomic.Bool
+}
+
+// WithBudget returns a copy of ctx that stops a sync gracefully, as if the
+// stop channel of WithStop was closed, once limit has passed. A stop that
+// was already requested through WithStop still applies. The sync then
+// returns ErrStopped and sets BudgetExceeded in its result. cancel releases
+// the timer and must be called once the sync is done.
+func WithBudget(ctx context.Context, limit time.Duration) (_ context.Context, cancel func()) {
+	parent := stopChan(ctx)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	select {
+	case <-parent:
+		close(stop)
+		return WithStop(ctx, stop), func() {}
+	default:
+	}
+	b := &budget{limit: limit}
+	timer := time.NewTimer(limit)
+	go func() {
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			b.exceeded.Store(true)
+			LogWarnf("The max_duration of %s is over, stopping after the lists being sent", limit)
+		case <-parent:
+		case <-done:
+			return
+		}
+		close(stop)
+	}()
+	ctx = context.WithValue(WithStop(ctx, stop), budgetKey{}, b)
+	var once sync.Once
+	return ctx, func() { once.Do(func() { close(done) }) }
+}
+
+// stopError returns ErrStopped for a sync that was stopped through ctx and
+// sets BudgetExceeded in result if the budget of WithBudget ran out.
+func stopError(ctx context.Context, result *SyncResult) error {
+	b, _ := ctx.Value(budgetKey{}).(*budget)
+	if b == nil || !b.exceeded.Load() {
+		return ErrStopped
+	}
+	result.BudgetExceeded = true
+	return fmt.Errorf("%w: max_duration of %s exceeded", ErrStopped, b.limit)
+}
+
+// stopChan returns the channel set by WithStop, or nil, which is never
+// ready, if there is none.
+func stopChan(ctx context.Context) <-chan struct{} {
+	stop, _ := ctx.Value(stopKey{}).(<-chan struct{})
+	return stop
+}
+
+// stopRequested reports whether the channel set by WithStop is closed.
+func stopRequested(ctx context.Context) bool {
+	select {
+	case <-stopChan(ctx):
+		return true
+	default:
+		return false
+	}
+}
+
+// ProgressFunc is called by SyncToFeedly after each list with the number of
+// lists processed so far, the total number of lists and the label of the
+// list that was just processed.
+type ProgressFunc func(done, total int, label string)
+
+// listJob is a single create (POST) or update (PUT) request planned by
+// planJobs for the CSV column Column. Entities is the number of entities the
+// request carries and Added the number of those that are new to the list.
+// Spilled holds the entities that no longer fit into the list after it was
+// planned again on a conflict; they are sent to overflow lists afterwards.
+type listJob struct {
+	Method   string
+	Column   string
+	List     FeedlyList
+	Entities int
+	Added    int
+	Before   int
+	Spilled  []FeedlyEntity
+}
+
+// SyncToFeedly uploads csvData to Feedly and reports what it did. The
+// planned requests are sent by Concurrency workers that share one rate
+// limiter allowing RequestsPerSecond. Every request waits for the limiter
+// before it is sent rather than pausing after it, so the first request goes
+// out at once and the sync returns as soon as the last one is answered. A
+// failed list does not stop the sync; all failures are logged, recorded in
+// the result and returned together once every list has been processed. In
+// dry run mode nothing is sent; the changes that would have been made are
+// logged and collected in the result's Plan instead. The result's Lists
+// hold the entity count of every list of the CSV columns before and after
+// the sync.
+// With RefetchAfterCreate the columns that create lists are synced first,
+// and the others only after the lists were fetched again.
+// Cancelling ctx stops the sync before the next request and returns
+// ctx.Err(); a stop requested through WithStop lets the lists being sent
+// finish, skips the rest and any pruning and returns ErrStopped, as does
+// running out of the budget of WithBudget. If progress is not nil it is
+// called after every processed list.
+func SyncToFeedly(ctx context.Context, client *http.Client, csvData map[string][]string, feedlyData []FeedlyList, config Config, progress ProgressFunc) (SyncResult, error) {
+	result := SyncResult{RunID: config.RunID, Errors: []ListError{}, Columns: countColumns(csvData)}
+	limiter := rate.NewLimiter(rate.Limit(config.RequestsPerSecond), 1)
+	var filled []string
+	for header, entries := range csvData {
+		if len(entries) > 0 {
+			filled = append(filled, header)
+		}
+	}
+	if err := checkNewLists(filled, feedlyData, config); err != nil {
+		return result, err
+	}
+	deletes := planDeletes(csvData, feedlyData, config)
+	if err := backupLists(csvData, feedlyData, config); err != nil {
+		return result, err
+	}
+	spread := make(keywordSpread)
+	for header, entries := range csvData {
+		spread.add(header, entries, config)
+	}
+	result.SharedKeywords = spread.shared(config)
+
+	errs, _, err := syncBatch(ctx, client, limiter, csvData, feedlyData, config, progress, &result)
+	if err != nil {
+		return result, err
+	}
+	return result, finishSync(ctx, client, limiter, deletes, errs, config, &result)
+}
+
+// syncBatch syncs the columns in csvData through syncLists. With
+// RefetchAfterCreate it returns the lists fetched again after lists were
+// created, otherwise feedlyData itself.
+func syncBatch(ctx context.Context, client *http.Client, limiter *rate.Limiter, csvData map[string][]string, feedlyData []FeedlyList, config Config, progress ProgressFunc, result *SyncResult) ([]error, []FeedlyList, error) {
+	if !config.RefetchAfterCreate || config.DryRun {
+		errs, err := syncLists(ctx, client, limiter, csvData, feedlyData, config, progress, result)
+		return errs, feedlyData, err
+	}
+
+	// The columns that create lists go first; the others are planned
+	// against the refetched lists, so that a column whose list was just
+	// created by another one adds to it instead of creating it again.
+	creates, updates := splitCreates(csvData, feedlyData, config)
+	created := result.ListsCreated
+	errs, err := syncLists(ctx, client, limiter, creates, feedlyData, config, progress, result)
+	if err != nil {
+		return errs, feedlyData, err
+	}
+	if result.ListsCreated > created {
+		if feedlyData, err = refetchFeedlyData(ctx, client, limiter, config); err != nil {
+			return errs, feedlyData, err
+		}
+	}
+	failed, err := syncLists(ctx, client, limiter, updates, feedlyData, config, progress, result)
+	return append(errs, failed...), feedlyData, err
+}
+
+// splitCreates splits csvData into the columns that create a list, as no
+// list of theirs exists in Feedly yet, and the other columns. Of several
+// columns that need the same new list only the first, by header, is among
+// the creating ones.
+func splitCreates(csvData map[string][]string, feedlyData []FeedlyList, config Config) (creates, updates map[string][]string) {
+	headers := make([]string, 0, len(csvData))
+	for header := range csvData {
+		headers = append(headers, header)
+	}
+	sort.Strings(headers)
+
+	creates = make(map[string][]string)
+	updates = make(map[string][]string)
+	created := make(map[string]bool)
+	for _, header := range headers {
+		listName, _ := columnListName(header, config)
+		if !created[listName] && len(csvData[header]) > 0 && len(columnLists(header, listName, feedlyData, config)) == 0 {
+			created[listName] = true
+			creates[header] = csvData[header]
+			continue
+		}
+		updates[header] = csvData[header]
+	}
+	return creates, updates
+}
+
+// refetchFeedlyData fetches the lists again after lists were created, for
+// RefetchAfterCreate. It waits for the limiter like every other request.
+func refetchFeedlyData(ctx context.Context, client *http.Client, limiter *rate.Limiter, config Config) ([]FeedlyList, error) {
+	if err := limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	LogDebugf("Fetching the Feedly lists again after creating lists")
+	feedlyData, err := FetchFeedlyData(ctx, client, config)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching Feedly data after creating lists: %w", err)
+	}
+	return feedlyData, nil
+}
+
+// SyncColumns is SyncToFeedly for columns that are read in batches: each
+// batch of up to Concurrency columns is read in one pass over the files and
+// its lists are sent through the worker pool before the next batch is read,
+// so only one batch's entries are held in memory. Lists are pruned once
+// every column has been synced. progress counts the lists of the current
+// batch. With RefetchAfterCreate the lists are fetched again after every
+// batch that created lists, so that the next batches see them. After a stop
+// requested through WithStop no further batch is read.
+func SyncColumns(ctx context.Context, client *http.Client, columns *ColumnIterator, feedlyData []FeedlyList, config Config, progress ProgressFunc) (SyncResult, error) {
+	result := SyncResult{RunID: config.RunID, Errors: []ListError{}, Columns: []ColumnCount{}}
+	limiter := rate.NewLimiter(rate.Limit(config.RequestsPerSecond), 1)
+
+	// Pruning and the backup only need to know which columns exist, not
+	// their entries.
+	headers := make(map[string][]string)
+	for _, header := range columns.Headers() {
+		headers[header] = nil
+	}
+	if err := checkNewLists(columns.FilledHeaders(), feedlyData, config); err != nil {
+		return result, err
+	}
+	if err := backupLists(headers, feedlyData, config); err != nil {
+		return result, err
+	}
+	var errs []error
+	for {
+		batch, err := columns.NextBatch(ctx, config.Concurrency)
+		if err != nil {
+			return result, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		result.Columns = append(result.Columns, countColumns(batch)...)
+
+		var failed []error
+		failed, feedlyData, err = syncBatch(ctx, client, limiter, batch, feedlyData, config, progress, &result)
+		if err != nil {
+			return result, err
+		}
+		for header := range batch {
+			result.capColumn(header, columns.Capped(header))
+		}
+		errs = append(errs, failed...)
+	}
+	result.Warnings = columns.Warnings()
+	result.KeywordsDropped = columns.Dropped()
+	result.SharedKeywords = columns.SharedKeywords()
+
+	deletes := planDeletes(headers, feedlyData, config)
+	return result, finishSync(ctx, client, limiter, deletes, errs, config, &result)
+}
+
+// syncLists plans and sends the requests for the columns in csvData and
+// records them in result. It returns the errors of the lists that failed,
+// and a non-nil err only if the sync cannot go on, because ctx was
+// cancelled or the state file could not be read.
+func syncLists(ctx context.Context, client *http.Client, limiter *rate.Limiter, csvData map[string][]string, feedlyData []FeedlyList, config Config, progress ProgressFunc, result *SyncResult) (failed []error, err error) {
+	var state syncState
+	if config.StateFile != "" {
+		if state, err = loadState(config.StateFile); err != nil {
+			return nil, err
+		}
+		if !config.Force {
+			csvData = skipUnchanged(csvData, state, config, result)
+		}
+	}
+	jobs := planJobs(csvData, feedlyData, config)
+	result.Lists = append(result.Lists, countLists(csvData, feedlyData, jobs, config)...)
+
+	if config.DryRun {
+		for _, job := range jobs {
+			result.Plan = append(result.Plan, planChange(job.Method, job.List.Label, job.List.Entities))
+			result.record(job)
+		}
+		return nil, nil
+	}
+
+	// The workers share result, failed, failedColumns and done and only
+	// touch them while holding mu, so no count is lost when several lists
+	// finish at the same time. Requests are sent without the lock.
+	var (
+		mu            sync.Mutex
+		failedColumns = make(map[string]bool)
+		created       = make(map[string]bool)
+		done          int
+		skipped       int
+		spilled       []listJob
+	)
+	// finish records a sent job; the caller holds mu.
+	finish := func(job listJob, id string, err error) {
+		if err == nil {
+			result.record(job)
+			if job.Method == "POST" {
+				result.CreatedLists = append(result.CreatedLists, CreatedList{Label: job.List.Label, ID: id})
+				created[job.Column] = true
+			}
+			if len(job.Spilled) > 0 {
+				spilled = append(spilled, job)
+			}
+		} else if ctx.Err() == nil {
+			LogErrorf("Failed to sync list %q: %v", job.List.Label, err)
+			result.addError(job.List.Label, job.Entities, err)
+			result.failList(job.List.Label)
+			failedColumns[job.Column] = true
+			failed = append(failed, fmt.Errorf("list %q: %w", job.List.Label, err))
+		}
+	}
+	var wg sync.WaitGroup
+	queue := make(chan listJob)
+
+	for i := 0; i < config.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				var id string
+				err := limiter.Wait(ctx)
+				if err == nil && stopRequested(ctx) {
+					// The job was taken before the stop; it is not sent
+					// and its column is not recorded as synced.
+					mu.Lock()
+					result.failList(job.List.Label)
+					failedColumns[job.Column] = true
+					skipped++
+					mu.Unlock()
+					continue
+				}
+				if err == nil {
+					job, id, err = sendJob(ctx, client, limiter, job, config)
+				}
+
+				mu.Lock()
+				finish(job, id, err)
+				done++
+				if progress != nil && ctx.Err() == nil {
+					progress(done, len(jobs), job.List.Label)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	sent := 0
+send:
+	for _, job := range jobs {
+		select {
+		case queue <- job:
+			sent++
+		case <-ctx.Done():
+			break send
+		case <-stopChan(ctx):
+			break send
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if len(spilled) > 0 && ctx.Err() == nil && !stopRequested(ctx) {
+		overflow, err := planSpilled(ctx, client, limiter, spilled, config)
+		if err != nil && ctx.Err() == nil {
+			// The spilled entities stay unsynced, so their columns are
+			// synced again by the next run.
+			LogErrorf("Failed to plan the overflow lists of a changed list: %v", err)
+			for _, job := range spilled {
+				result.addError(job.List.Label, len(job.Spilled), err)
+				failedColumns[job.Column] = true
+			}
+			failed = append(failed, err)
+		}
+		for _, job := range overflow {
+			if err := limiter.Wait(ctx); err != nil {
+				break
+			}
+			job, id, err := sendJob(ctx, client, limiter, job, config)
+			finish(job, id, err)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return failed, err
+	}
+	stopped := stopRequested(ctx)
+	if stopped {
+		// The lists that were never queued keep their counts, and their
+		// columns must be synced again by the next run.
+		for _, job := range jobs[sent:] {
+			result.failList(job.List.Label)
+			failedColumns[job.Column] = true
+		}
+	} else {
+		recordOrphans(csvData, feedlyData, created, config, result)
+	}
+	if config.StateFile != "" {
+		updateState(state, csvData, failedColumns, config)
+	}
+	if stopped {
+		LogWarnf("Sync stopped, %d of %d lists of this run were not sent", len(jobs)-sent+skipped, len(jobs))
+		return failed, stopError(ctx, result)
+	}
+	return failed, nil
+}
+
+// recordOrphans adds the columns of csvData that have entries but no list in
+// Feedly and for which no list could be created to result.Orphans. created
+// holds the columns that created at least one list.
+func recordOrphans(csvData map[string][]string, feedlyData []FeedlyList, created map[string]bool, config Config, result *SyncResult) {
+	var orphans []string
+	for header, entries := range csvData {
+		listName, _ := columnListName(header, config)
+		if len(entries) == 0 || created[header] || len(columnLists(header, listName, feedlyData, config)) > 0 {
+			continue
+		}
+		LogWarnf("Warning: the %d keywords of column %q went nowhere, list %q does not exist and could not be created", len(entries), header, listName)
+		orphans = append(orphans, header)
+	}
+	sort.Strings(orphans)
+	result.Orphans = append(result.Orphans, orphans...)
+}
+
+// finishSync looks up the IDs of the created lists and then deletes the
+// obsolete lists. It returns errs joined together with any failed deletes.
+func finishSync(ctx context.Context, client *http.Client, limiter *rate.Limiter, deletes []listJob, errs []error, config Config, result *SyncResult) error {
+	if config.DryRun {
+		for _, job := range deletes {
+			result.Plan = append(result.Plan, planChange(job.Method, job.List.Label, job.List.Entities))
+			result.record(job)
+		}
+		return nil
+	}
+	resolveCreatedIDs(ctx, client, result, config)
+	if config.FailOnOrphan && len(result.Orphans) > 0 {
+		errs = append(errs, fmt.Errorf("%w: %s", ErrOrphanColumns, strings.Join(result.Orphans, ", ")))
+	}
+
+	// Lists are only pruned after everything else went through, so a failed
+	// sync never leaves Feedly with fewer lists than before.
+	if len(errs) > 0 {
+		if len(deletes) > 0 {
+			LogWarnf("Not deleting %d obsolete lists because the sync had errors", len(deletes))
+		}
+		return errors.Join(errs...)
+	}
+	for _, job := range deletes {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+		if stopRequested(ctx) {
+			return stopError(ctx, result)
+		}
+		if _, err := sendList(ctx, client, job.Method, job.List, config); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			LogErrorf("Failed to delete list %q: %v", job.List.Label, err)
+			result.addError(job.List.Label, 0, err)
+			errs = append(errs, fmt.Errorf("list %q: %w", job.List.Label, err))
+			continue
+		}
+		LogInfof("Deleted list %q", job.List.Label)
+		result.record(job)
+	}
+	return errors.Join(errs...)
+}
+
+// checkNewLists returns ErrTooManyLists if more than MaxListsPerRun of the
+// columns with entries, given by their headers, have no list in Feedly yet
+// and would each create one, which is what a malformed file, such as a
+// transposed export, looks like. Empty columns create nothing and must not
+// be passed. It is called before anything is sent; a MaxListsPerRun of 0
+// means no limit.
+func checkNewLists(headers []string, feedlyData []FeedlyList, config Config) error {
+	if config.MaxListsPerRun == 0 {
+		return nil
+	}
+	var missing []string
+	for _, header := range headers {
+		listName, _ := columnListName(header, config)
+		if len(columnLists(header, listName, feedlyData, config)) == 0 {
+			missing = append(missing, header)
+		}
+	}
+	if len(missing) <= config.MaxListsPerRun {
+		return nil
+	}
+	sort.Strings(missing)
+	return fmt.Errorf("%w: %d columns would create new lists, more than max_lists_per_run (%d) allows; check the CSV file or raise the limit (first columns: %s)",
+		ErrTooManyLists, len(missing), config.MaxListsPerRun, strings.Join(missing[:clamp(5, 0, len(missing))], ", "))
+}
+
+// planDeletes returns a DELETE job for every Feedly list that matches
+// PrunePattern but no longer belongs to any CSV column. Nothing is pruned
+// unless PruneMissing is set, and never while column filters are active or
+// the CSV has no columns, as every list would then look obsolete.
+func planDeletes(csvData map[string][]string, feedlyData []FeedlyList, config Config) []listJob {
+	if !config.PruneMissing {
+		return nil
+	}
+	if config.OnlyCreate {
+		LogWarnf("Not pruning lists because only_create is set")
+		return nil
+	}
+	if len(csvData) == 0 {
+		LogWarnf("Not pruning lists because the CSV has no columns")
+		return nil
+	}
+	if len(config.IncludeColumns) > 0 || len(config.ExcludeColumns) > 0 {
+		LogWarnf("Not pruning lists while include_columns or exclude_columns is set")
+		return nil
+	}
+
+	pattern := regexp.MustCompile(config.PrunePattern)
+	var jobs []listJob
+	for _, list := range feedlyData {
+		if !pattern.MatchString(list.Label) || belongsToColumn(list, csvData, config) {
+			continue
+		}
+		jobs = append(jobs, listJob{Method: "DELETE", List: list})
+	}
+	return jobs
+}
+
+// ListsToPrune returns the Feedly lists that a sync of csvData would
+// delete because of PruneMissing. Only the headers of csvData are used.
+func ListsToPrune(csvData map[string][]string, feedlyData []FeedlyList, config Config) []FeedlyList {
+	var lists []FeedlyList
+	for _, job := range planDeletes(csvData, feedlyData, config) {
+		lists = append(lists, job.List)
+	}
+	return lists
+}
+
+// belongsToColumn reports whether the Feedly list is the list of one of the
+// CSV columns, by its configured ID or its label, or one of its overflow
+// lists.
+func belongsToColumn(list FeedlyList, csvData map[string][]string, config Config) bool {
+	for header := range csvData {
+		listName, _ := columnListName(header, config)
+		if id := columnListID(header, config); id != "" && list.ID == id {
+			return true
+		}
+		if matchesListName(list.Label, listName, config) || overflowIndex(list.Label, listName, config.OverflowLabelFormat) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// columnLists returns the Feedly lists that belong to the CSV column header.
+// If ListIDs assigns the column a list ID, that list is matched by ID, so it
+// is still found after it was renamed in Feedly; with PrefixMatch its
+// overflow lists are matched by label as usual. Columns without an ID, or
+// whose ID is not in Feedly, are matched by label.
+func columnLists(header, listName string, feedlyData []FeedlyList, config Config) []FeedlyList {
+	id := columnListID(header, config)
+	if id != "" {
+		found := false
+		for _, list := range feedlyData {
+			if list.ID == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			LogWarnf("Warning: list ID %q of column %q was not found in Feedly, matching the list by label instead", id, header)
+			id = ""
+		}
+	}
+
+	var lists []FeedlyList
+	for _, list := range feedlyData {
+		if id == "" {
+			if matchesListName(list.Label, listName, config) {
+				lists = append(lists, list)
+			}
+		} else if list.ID == id || (config.PrefixMatch && overflowIndex(list.Label, listName, config.OverflowLabelFormat) > 1) {
+			lists = append(lists, list)
+		}
+	}
+	return lists
+}
+
+// sendJob sends a planned request. If Feedly answers that the list was
+// changed since it was fetched (409 or 412), the list is fetched again, the
+// update is planned against the fresh list and sent again, up to
+// ConflictRetries times. New entities that no longer fit into the fresh
+// list are left in Spilled. It returns the job that was finally sent.
+func sendJob(ctx context.Context, client *http.Client, limiter *rate.Limiter, job listJob, config Config) (listJob, string, error) {
+	for attempt := 1; ; attempt++ {
+		id, err := sendList(ctx, client, job.Method, job.List, config)
+		if !errors.Is(err, errConflict) || job.Method != "PUT" || attempt > config.ConflictRetries {
+			return job, id, err
+		}
+		LogWarnf("List %q was changed in Feedly during the sync, fetching it again (attempt %d of %d)", job.List.Label, attempt, config.ConflictRetries)
+
+		if err := limiter.Wait(ctx); err != nil {
+			return job, "", err
+		}
+		feedlyData, err := FetchFeedlyData(ctx, client, config)
+		if err != nil {
+			return job, "", err
+		}
+		var fresh FeedlyList
+		found := false
+		for _, list := range feedlyData {
+			if list.ID == job.List.ID {
+				fresh, found = list, true
+				break
+			}
+		}
+		if !found {
+			return job, "", fmt.Errorf("list %q was deleted in Feedly during the sync", job.List.Label)
+		}
+
+		if config.SyncMode == syncModeReplace {
+			job.Added, _ = entityDiff(fresh.Entities, job.List.Entities)
+		} else {
+			// Only the entities the job adds are planned again; the
+			// rest of the list is taken from the fresh one. Whatever no
+			// longer fits into it is spilled to overflow lists.
+			added := append(append(make([]FeedlyEntity, 0, len(job.List.Entities)-job.Before+len(job.Spilled)), job.List.Entities[job.Before:]...), job.Spilled...)
+			pending := withoutExisting(added, []FeedlyList{fresh})
+			base := job.List
+			base.Entities = fresh.Entities
+			n := clamp(config.MaxEntitiesPerList-len(fresh.Entities), 0, len(pending))
+			n = fitPayload(base, pending[:n], config.MaxPayloadBytes)
+			job.Spilled = pending[n:]
+			if n == 0 {
+				if len(job.Spilled) == 0 {
+					LogInfof("No changes for %q", job.List.Label)
+				}
+				job.List.Entities = fresh.Entities
+				job.Entities, job.Added, job.Before = 0, 0, len(fresh.Entities)
+				return job, fresh.ID, nil
+			}
+			job.List.Entities = append(append(make([]FeedlyEntity, 0, len(fresh.Entities)+n), fresh.Entities...), pending[:n]...)
+			job.Entities, job.Added, job.Before = n, n, len(fresh.Entities)
+		}
+		if err := limiter.Wait(ctx); err != nil {
+			return job, "", err
+		}
+	}
+}
+
+// resolveCreatedIDs fills in the IDs of created lists whose POST response
+// did not include one by refetching the lists and matching them by label.
+// The IDs are informational, so a failed refetch is only logged.
+func resolveCreatedIDs(ctx context.Context, client *http.Client, result *SyncResult, config Config) {
+	missing := false
+	for _, created := range result.CreatedLists {
+		if created.ID == "" {
+			missing = true
+			break
+		}
+	}
+	if missing {
+		feedlyData, err := FetchFeedlyData(ctx, client, config)
+		if err != nil {
+			LogWarnf("Could not look up the IDs of the created lists: %v", err)
+		} else {
+			for i, created := range result.CreatedLists {
+				if created.ID != "" {
+					continue
+				}
+				for _, list := range feedlyData {
+					if list.Label == created.Label {
+						result.CreatedLists[i].ID = list.ID
+						break
+					}
+				}
+			}
+		}
+	}
+
+	for _, created := range result.CreatedLists {
+		LogInfof("Created list %q with ID %q", created.Label, created.ID)
+	}
+}
+
+// planJobs works out the requests needed to bring Feedly in line with
+// csvData without sending any of them. With OnlyCreate, columns that
+// already have a list in Feedly are left alone, so only POSTs are planned.
+func planJobs(csvData map[string][]string, feedlyData []FeedlyList, config Config) []listJob {
+	var jobs []listJob
+
+	for header, entries := range csvData {
+		if len(entries) == 0 {
+			continue
+		}
+		listName, entityType := columnListName(header, config)
+
+		existingLists := columnLists(header, listName, feedlyData, config)
+		// Without PrefixMatch the column's overflow lists are not updated,
+		// but they are still its own: their entities are not added again
+		// and their labels are not taken for new lists.
+		ownLists := existingLists
+		taken := make(map[int]bool)
+		for _, list := range feedlyData {
+			index := overflowIndex(list.Label, listName, config.OverflowLabelFormat)
+			if index == 0 {
+				continue
+			}
+			taken[index] = true
+			if index > 1 && !containsList(ownLists, list.ID) {
+				ownLists = append(ownLists[:len(ownLists):len(ownLists)], list)
+			}
+		}
+		if len(existingLists) > 0 {
+			// A list matched by ID may have been renamed; new lists still
+			// must not take the column's own label.
+			taken[1] = true
+		}
+		if config.OnlyCreate && len(ownLists) > 0 {
+			LogInfof("Skipping column %q, list %q already exists and only_create is set", header, ownLists[0].Label)
+			continue
+		}
+
+		var entities []FeedlyEntity
+		for _, entry := range entries {
+			text, salience := splitWeight(entry, config)
+			entities = append(entities, FeedlyEntity{
+				Type:     entityType,
+				Text:     text,
+				Salience: salience,
+			})
+		}
+
+		// Entries that are already in one of the lists need no request
+		// at all. In replace mode the updated lists are rewritten, so only
+		// the lists that are left alone count.
+		remaining := withoutExisting(entities, ownLists)
+		if config.SyncMode == syncModeReplace {
+			remaining = withoutExisting(entities, ownLists[len(existingLists):])
+		}
+		for _, list := range existingLists {
+			var n, added int
+			if config.SyncMode == syncModeReplace {
+				// The CSV column is the authoritative set: every existing
+				// list is rewritten and lists that are no longer needed
+				// are emptied.
+				n = clamp(config.MaxEntitiesPerList, 0, len(remaining))
+				empty := list
+				empty.Entities = nil
+				n = fitPayload(empty, remaining[:n], config.MaxPayloadBytes)
+				var removed int
+				added, removed = entityDiff(list.Entities, remaining[:n])
+				if added == 0 && removed == 0 && len(list.Entities) == n {
+					LogInfof("No changes for %q", list.Label)
+					remaining = remaining[n:]
+					continue
+				}
+				LogInfof("Replacing entities of %q: %d added, %d removed", list.Label, added, removed)
+			} else {
+				if len(remaining) == 0 {
+					LogInfof("No changes for %q", list.Label)
+					continue
+				}
+				// A list can already hold more than MaxEntitiesPerList
+				// entities if the limit was lowered; clamp keeps the
+				// bound from going negative.
+				n = clamp(config.MaxEntitiesPerList-len(list.Entities), 0, len(remaining))
+				n = fitPayload(list, remaining[:n], config.MaxPayloadBytes)
+				if n == 0 {
+					continue
+				}
+				added = n
+			}
+
+			before := len(list.Entities)
+			if config.SyncMode == syncModeReplace {
+				list.Entities = remaining[:n]
+			} else {
+				// A PUT replaces the entities of the list, so it carries
+				// the existing ones followed by the new ones. The slice is
+				// copied to leave feedlyData untouched.
+				list.Entities = append(append(make([]FeedlyEntity, 0, before+n), list.Entities...), remaining[:n]...)
+			}
+			remaining = remaining[n:]
+			jobs = append(jobs, listJob{Method: "PUT", Column: header, List: list, Entities: n, Added: added, Before: before})
+		}
+
+		// Whatever did not fit into the existing lists spills over into
+		// new lists named by OverflowLabelFormat, "<listName> 2",
+		// "<listName> 3" and so on by default, skipping any label that is
+		// already taken in Feedly. A column without a list starts with
+		// its own label.
+		jobs = append(jobs, overflowJobs(header, listName, remaining, taken, config)...)
+	}
+
+	return jobs
+}
+
+// overflowJobs plans the POSTs that put entities into new lists of the
+// column header, skipping the indices in taken and marking the ones it
+// uses.
+func overflowJobs(header, listName string, entities []FeedlyEntity, taken map[int]bool, config Config) []listJob {
+	var jobs []listJob
+	for index := 1; len(entities) > 0; index++ {
+		if taken[index] {
+			continue
+		}
+		taken[index] = true
+		n := clamp(config.MaxEntitiesPerList, 0, len(entities))
+		newList := FeedlyList{
+			Label: overflowLabel(listName, index, config.OverflowLabelFormat),
+			Type:  columnListType(header, config),
+		}
+		// An entity too large for a list of its own still gets one;
+		// sendList then fails that list instead of sending it.
+		n = max(fitPayload(newList, entities[:n], config.MaxPayloadBytes), 1)
+		newList.Entities = entities[:n]
+		entities = entities[n:]
+		jobs = append(jobs, listJob{Method: "POST", Column: header, List: newList, Entities: n, Added: n})
+	}
+	return jobs
+}
+
+// planSpilled plans overflow lists for the entities that the jobs spilled
+// after a conflict. The lists are fetched again first, so that the new
+// lists only take labels that are still free.
+func planSpilled(ctx context.Context, client *http.Client, limiter *rate.Limiter, spilled []listJob, config Config) ([]listJob, error) {
+	if err := limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	feedlyData, err := FetchFeedlyData(ctx, client, config)
+	if err != nil {
+		return nil, err
+	}
+	var jobs []listJob
+	taken := make(map[string]map[int]bool)
+	for _, job := range spilled {
+		listName, _ := columnListName(job.Column, config)
+		if taken[job.Column] == nil {
+			// The list the job updated keeps the column's own label.
+			taken[job.Column] = map[int]bool{1: true}
+			for _, list := range feedlyData {
+				if index := overflowIndex(list.Label, listName, config.OverflowLabelFormat); index > 0 {
+					taken[job.Column][index] = true
+				}
+			}
+		}
+		jobs = append(jobs, overflowJobs(job.Column, listName, job.Spilled, taken[job.Column], config)...)
+	}
+	return jobs, nil
+}
+
+// containsList reports whether lists contains the list with the given ID.
+func containsList(lists []FeedlyList, id string) bool {
+	for _, list := range lists {
+		if list.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutExisting returns the entities whose text is not in any of the
+// lists.
+func withoutExisting(entities []FeedlyEntity, lists []FeedlyList) []FeedlyEntity {
+	existing := make(map[string]bool)
+	for _, list := range lists {
+		for _, entity := range list.Entities {
+			existing[entity.Text] = true
+		}
+	}
+
+	var missing []FeedlyEntity
+	for _, entity := range entities {
+		if !existing[entity.Text] {
+			missing = append(missing, entity)
+		}
+	}
+	return missing
+}
+
+// entityDiff counts the entities in desired that current lacks and the
+// entities in current that desired no longer contains. An entity whose
+// salience changed counts as added.
+func entityDiff(current, desired []FeedlyEntity) (added, removed int) {
+	currentSalience := make(map[string]float64, len(current))
+	for _, entity := range current {
+		currentSalience[entity.Text] = entity.Salience
+	}
+	desiredTexts := make(map[string]bool, len(desired))
+	for _, entity := range desired {
+		desiredTexts[entity.Text] = true
+		if salience, ok := currentSalience[entity.Text]; !ok || salience != entity.Salience {
+			added++
+		}
+	}
+	for _, entity := range current {
+		if !desiredTexts[entity.Text] {
+			removed++
+		}
+	}
+	return added, removed
+}
+
+func planChange(method, label string, entities []FeedlyEntity) string {
+	texts := make([]string, len(entities))
+	for i, entity := range entities {
+		texts[i] = entity.Text
+	}
+	change := fmt.Sprintf("%s %q: %s", method, label, strings.Join(texts, ", "))
+	if method == "DELETE" {
+		change = fmt.Sprintf("%s %q", method, label)
+	}
+	LogInfof("Dry run: %s", change)
+	return change
+}
+
+// matchesListName reports whether the Feedly list label belongs to the CSV
+// column listName. Only the exact name matches unless PrefixMatch is set, in
+// which case the column's overflow lists ("Tech 2", "Tech 3") match too.
+func matchesListName(label, listName string, config Config) bool {
+	if config.PrefixMatch {
+		return overflowIndex(label, listName, config.OverflowLabelFormat) > 0
+	}
+	return label == listName
+}
+
+// indexPlaceholder matches the {index} placeholder of OverflowLabelFormat.
+// {index:N} pads the index with zeros to N digits.
+var indexPlaceholder = regexp.MustCompile(`\{index(?::([1-9]))?\}`)
+
+// overflowIndex is the inverse of overflowLabel. It returns 1 if label is
+// listName itself, N if it is the N-th overflow list as named by format and
+// 0 if the label belongs to something else, such as "Technology" for "Tech".
+func overflowIndex(label, listName, format string) int {
+	if label == listName {
+		return 1
+	}
+	loc := indexPlaceholder.FindStringIndex(format)
+	if loc == nil {
+		return 0
+	}
+	prefix := strings.Replace(format[:loc[0]], "{label}", listName, 1)
+	suffix := strings.Replace(format[loc[1]:], "{label}", listName, 1)
+	digits, ok := strings.CutPrefix(label, prefix)
+	if !ok {
+		return 0
+	}
+	if digits, ok = strings.CutSuffix(digits, suffix); !ok {
+		return 0
+	}
+	index, err := strconv.Atoi(digits)
+	// Formatting the index again rejects signs and padding that format
+	// would not produce, so "Tech 02" is not taken for "Tech 2".
+	if err != nil || index < 2 || overflowLabel(listName, index, format) != label {
+		return 0
+	}
+	return index
+}
+
+// overflowLabel returns the label of the index-th list for a CSV column,
+// counting from 1. The first list keeps the column name; the others are
+// named by format, such as "{label} {index}" for "Tech 2".
+func overflowLabel(listName string, index int, format string) string {
+	if index <= 1 {
+		return listName
+	}
+	label := indexPlaceholder.ReplaceAllStringFunc(format, func(placeholder string) string {
+		width, _ := strconv.Atoi(indexPlaceholder.FindStringSubmatch(placeholder)[1])
+		return fmt.Sprintf("%0*d", width, index)
+	})
+	return strings.Replace(label, "{label}", listName, 1)
+}
+
+// clamp limits n to the range [lo, hi].
+func clamp(n, lo, hi int) int {
+	if n < lo {
+		return lo
+	}
+	if n > hi {
+		return hi
+	}
+	return n
+}
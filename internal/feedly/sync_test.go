@@ -0,0 +1,570 @@
+package feedly
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyncPutKeepsExistingEntities(t *testing.T) {
+	var existing, added []string
+	for i := 1; i <= 10; i++ {
+		existing = append(existing, fmt.Sprintf("old%d", i))
+	}
+	for i := 1; i <= 5; i++ {
+		added = append(added, fmt.Sprintf("new%d", i))
+	}
+	f := newFakeFeedly(t, FeedlyList{ID: "tech", Label: "Tech", Type: defaultListType, Entities: keywords(existing...)})
+
+	if _, err := syncFake(t, f, map[string][]string{"Tech": added}, testConfig(f.URL)); err != nil {
+		t.Fatalf("SyncToFeedly: %v", err)
+	}
+	sent := f.sent()
+	if len(sent) != 1 || sent[0].Method != "PUT" || len(sent[0].List.Entities) != 15 {
+		t.Fatalf("requests = %v, want a single PUT of 15 entities", f.methods())
+	}
+	if got := len(f.list("Tech").Entities); got != 15 {
+		t.Errorf("Tech holds %d entities, want 15", got)
+	}
+}
+
+func TestSyncConflictTwiceInARow(t *testing.T) {
+	f := newFakeFeedly(t, FeedlyList{ID: "tech", Label: "Tech", Type: defaultListType, Entities: keywords("a")})
+	// Another client adds "b" before the first PUT and deletes it again
+	// before the second.
+	conflicts := 0
+	f.status = func(r *http.Request, list FeedlyList) int {
+		if r.Method != "PUT" || conflicts == 2 {
+			return 0
+		}
+		conflicts++
+		if conflicts == 1 {
+			f.lists[0].Entities = keywords("a", "b")
+		} else {
+			f.lists[0].Entities = keywords("a")
+		}
+		return http.StatusConflict
+	}
+	config := testConfig(f.URL)
+	config.ConflictRetries = 2
+
+	result, err := syncFake(t, f, map[string][]string{"Tech": {"a", "x"}}, config)
+	if err != nil {
+		t.Fatalf("SyncToFeedly: %v", err)
+	}
+	if got, want := texts(f.list("Tech").Entities), "a,x"; got != want {
+		t.Errorf("Tech holds %s, want %s", got, want)
+	}
+	if result.EntitiesAdded != 1 {
+		t.Errorf("EntitiesAdded = %d, want 1", result.EntitiesAdded)
+	}
+}
+
+func TestSyncConflictSpillsIntoOverflow(t *testing.T) {
+	f := newFakeFeedly(t, FeedlyList{ID: "tech", Label: "Tech", Type: defaultListType, Entities: keywords("a")})
+	// Another client fills the list up before the PUT.
+	conflicted := false
+	f.status = func(r *http.Request, list FeedlyList) int {
+		if r.Method != "PUT" || conflicted {
+			return 0
+		}
+		conflicted = true
+		f.lists[0].Entities = keywords("a", "b")
+		return http.StatusConflict
+	}
+	config := testConfig(f.URL)
+	config.ConflictRetries = 1
+	config.MaxEntitiesPerList = 3
+
+	result, err := syncFake(t, f, map[string][]string{"Tech": {"a", "x", "y"}}, config)
+	if err != nil {
+		t.Fatalf("SyncToFeedly: %v", err)
+	}
+	got := texts(f.list("Tech").Entities) + "|" + texts(f.list("Tech 2").Entities)
+	if want := "a,b,x|y"; got != want {
+		t.Errorf("entities = %s after %v, want %s", got, f.methods(), want)
+	}
+	if result.EntitiesAdded != 2 || result.ListsCreated != 1 {
+		t.Errorf("EntitiesAdded = %d, ListsCreated = %d, want 2 and 1", result.EntitiesAdded, result.ListsCreated)
+	}
+}
+
+func TestSyncPayloadLimitSpillsIntoOverflow(t *testing.T) {
+	f := newFakeFeedly(t, FeedlyList{ID: "tech", Label: "Tech", Type: defaultListType, Entities: keywords("old1", "old2")})
+	config := testConfig(f.URL)
+	config.MaxPayloadBytes = 180
+
+	if _, err := syncFake(t, f, map[string][]string{"Tech": {"new1", "new2", "new3", "new4", "new5"}}, config); err != nil {
+		t.Fatalf("SyncToFeedly: %v", err)
+	}
+	for _, req := range f.sent() {
+		payload, err := json.Marshal(req.List)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(payload) > config.MaxPayloadBytes {
+			t.Errorf("%s of %q is %d bytes, want at most %d", req.Method, req.List.Label, len(payload), config.MaxPayloadBytes)
+		}
+	}
+	got := texts(f.list("Tech").Entities) + "|" + texts(f.list("Tech 2").Entities) + "|" + texts(f.list("Tech 3").Entities)
+	if want := "old1,old2,new1|new2,new3,new4|new5"; got != want {
+		t.Errorf("entities = %s after %v, want %s", got, f.methods(), want)
+	}
+}
+
+func TestSyncEntityLargerThanPayloadLimit(t *testing.T) {
+	f := newFakeFeedly(t)
+	config := testConfig(f.URL)
+	config.MaxPayloadBytes = 80
+
+	_, err := syncFake(t, f, map[string][]string{"Tech": {strings.Repeat("x", 100)}}, config)
+	if err == nil || !strings.Contains(err.Error(), "max_payload_bytes") {
+		t.Fatalf("SyncToFeedly error = %v, want one naming max_payload_bytes", err)
+	}
+	if sent := f.sent(); len(sent) != 0 {
+		t.Errorf("sent %d requests, want none", len(sent))
+	}
+}
+
+func TestSyncOverflowListsAreNotDuplicated(t *testing.T) {
+	for _, prefixMatch := range []bool{false, true} {
+		t.Run(fmt.Sprintf("prefix_match=%v", prefixMatch), func(t *testing.T) {
+			f := newFakeFeedly(t)
+			config := testConfig(f.URL)
+			config.MaxEntitiesPerList = 3
+			config.PrefixMatch = prefixMatch
+			csvData := map[string][]string{"Tech": {"a", "b", "c", "d", "e", "f", "g"}}
+
+			for run := 1; run <= 3; run++ {
+				if _, err := syncFake(t, f, csvData, config); err != nil {
+					t.Fatalf("run %d: SyncToFeedly: %v", run, err)
+				}
+			}
+			if got, want := fmt.Sprint(f.labels()), "[Tech Tech 2 Tech 3]"; got != want {
+				t.Fatalf("lists = %s, want %s", got, want)
+			}
+			got := texts(f.list("Tech").Entities) + "|" + texts(f.list("Tech 2").Entities) + "|" + texts(f.list("Tech 3").Entities)
+			if want := "a,b,c|d,e,f|g"; got != want {
+				t.Errorf("entities = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestSyncCreatesBaseListBeforeOverflow(t *testing.T) {
+	f := newFakeFeedly(t, FeedlyList{ID: "tech2", Label: "Tech 2", Type: defaultListType, Entities: keywords("x")})
+	config := testConfig(f.URL)
+
+	if _, err := syncFake(t, f, map[string][]string{"Tech": {"x", "y"}}, config); err != nil {
+		t.Fatalf("SyncToFeedly: %v", err)
+	}
+	if got, want := fmt.Sprint(f.labels()), "[Tech Tech 2]"; got != want {
+		t.Fatalf("lists = %s, want %s", got, want)
+	}
+	if got := texts(f.list("Tech").Entities); got != "y" {
+		t.Errorf("Tech holds %s, want y", got)
+	}
+}
+
+func TestSyncDoesNotMatchLongerLabels(t *testing.T) {
+	for _, prefixMatch := range []bool{false, true} {
+		t.Run(fmt.Sprintf("prefix_match=%v", prefixMatch), func(t *testing.T) {
+			f := newFakeFeedly(t, FeedlyList{ID: "technology", Label: "Technology", Type: defaultListType, Entities: keywords("ai")})
+			config := testConfig(f.URL)
+			config.PrefixMatch = prefixMatch
+
+			if _, err := syncFake(t, f, map[string][]string{"Tech": {"ai", "golang"}}, config); err != nil {
+				t.Fatalf("SyncToFeedly: %v", err)
+			}
+			if got := texts(f.list("Technology").Entities); got != "ai" {
+				t.Errorf("Technology holds %s, want ai", got)
+			}
+			if got := texts(f.list("Tech").Entities); got != "ai,golang" {
+				t.Errorf("Tech holds %s, want ai,golang", got)
+			}
+		})
+	}
+}
+
+func TestOverflowIndex(t *testing.T) {
+	tests := []struct {
+		label, format string
+		want          int
+	}{
+		{"Tech", "{label} {index}", 1},
+		{"Tech 2", "{label} {index}", 2},
+		{"Tech 12", "{label} {index}", 12},
+		{"Technology", "{label} {index}", 0},
+		{"Tech 1", "{label} {index}", 0},
+		{"Tech 02", "{label} {index}", 0},
+		{"Tech (3)", "{label} ({index})", 3},
+		{"Tech_04", "{label}_{index:2}", 4},
+		{"Tech_4", "{label}_{index:2}", 0},
+	}
+	for _, test := range tests {
+		if got := overflowIndex(test.label, "Tech", test.format); got != test.want {
+			t.Errorf("overflowIndex(%q, %q) = %d, want %d", test.label, test.format, got, test.want)
+		}
+	}
+}
+
+func TestSyncColumnsSendsColumnsConcurrently(t *testing.T) {
+	var header, row []string
+	for i := 1; i <= 8; i++ {
+		header = append(header, fmt.Sprintf("Column %d", i))
+		row = append(row, fmt.Sprintf("keyword%d", i))
+	}
+	filename := writeFile(t, "data.csv", strings.Join(header, ",")+"\n"+strings.Join(row, ",")+"\n")
+	f := newFakeFeedly(t)
+	f.delay = 50 * time.Millisecond
+	config := testConfig(f.URL)
+	config.Concurrency = 8
+
+	columns, err := NewColumnIterator(context.Background(), []string{filename}, config)
+	if err != nil {
+		t.Fatalf("NewColumnIterator: %v", err)
+	}
+	result, err := SyncColumns(context.Background(), f.Client(), columns, nil, config, nil)
+	if err != nil {
+		t.Fatalf("SyncColumns: %v", err)
+	}
+	if result.ListsCreated != 8 || len(result.Columns) != 8 {
+		t.Errorf("created %d lists for %d columns, want 8 for 8", result.ListsCreated, len(result.Columns))
+	}
+	if f.peak < 2 {
+		t.Errorf("at most %d request was in flight, want the columns sent concurrently", f.peak)
+	}
+}
+
+func TestSyncConcurrentCounts(t *testing.T) {
+	var existing []FeedlyList
+	csvData := make(map[string][]string)
+	for i := 1; i <= 40; i++ {
+		header := fmt.Sprintf("Column %02d", i)
+		csvData[header] = []string{"a", "b", "c"}
+		if i%2 == 0 {
+			existing = append(existing, FeedlyList{ID: fmt.Sprintf("id-%d", i), Label: header, Type: defaultListType, Entities: keywords("a")})
+		}
+	}
+	f := newFakeFeedly(t, existing...)
+	config := testConfig(f.URL)
+	config.Concurrency = 8
+	var progressCalls int
+	progress := func(done, total int, label string) { progressCalls++ }
+
+	feedlyData, err := FetchFeedlyData(context.Background(), f.Client(), config)
+	if err != nil {
+		t.Fatalf("FetchFeedlyData: %v", err)
+	}
+	result, err := SyncToFeedly(context.Background(), f.Client(), csvData, feedlyData, config, progress)
+	if err != nil {
+		t.Fatalf("SyncToFeedly: %v", err)
+	}
+	if result.ListsCreated != 20 || result.ListsUpdated != 20 {
+		t.Errorf("got %d created and %d updated, want 20 and 20", result.ListsCreated, result.ListsUpdated)
+	}
+	if result.EntitiesAdded != 20*3+20*2 {
+		t.Errorf("got %d entities added, want %d", result.EntitiesAdded, 20*3+20*2)
+	}
+	if len(result.CreatedLists) != 20 || progressCalls != 40 || len(f.sent()) != 40 {
+		t.Errorf("got %d created lists, %d progress calls and %d requests, want 20, 40 and 40", len(result.CreatedLists), progressCalls, len(f.sent()))
+	}
+}
+
+func TestClamp(t *testing.T) {
+	tests := []struct{ n, lo, hi, want int }{
+		{-5, 0, 10, 0},
+		{0, 0, 10, 0},
+		{7, 0, 10, 7},
+		{12, 0, 10, 10},
+		{3, 0, 0, 0},
+	}
+	for _, test := range tests {
+		if got := clamp(test.n, test.lo, test.hi); got != test.want {
+			t.Errorf("clamp(%d, %d, %d) = %d, want %d", test.n, test.lo, test.hi, got, test.want)
+		}
+	}
+}
+
+func TestSyncListOverLimit(t *testing.T) {
+	var existing []string
+	for i := 1; i <= 55; i++ {
+		existing = append(existing, fmt.Sprintf("old%d", i))
+	}
+	f := newFakeFeedly(t, FeedlyList{ID: "tech", Label: "Tech", Type: defaultListType, Entities: keywords(existing...)})
+	config := testConfig(f.URL)
+	config.MaxEntitiesPerList = 50
+
+	result, err := syncFake(t, f, map[string][]string{"Tech": {"new1", "new2"}}, config)
+	if err != nil {
+		t.Fatalf("SyncToFeedly: %v", err)
+	}
+	if got := fmt.Sprint(f.methods()); got != "[POST]" {
+		t.Errorf("requests = %s, want only the POST of the overflow list", got)
+	}
+	if result.ListsUpdated != 0 || len(f.list("Tech").Entities) != 55 {
+		t.Errorf("Tech was updated to %d entities", len(f.list("Tech").Entities))
+	}
+	if got := texts(f.list("Tech 2").Entities); got != "new1,new2" {
+		t.Errorf("Tech 2 holds %s, want new1,new2", got)
+	}
+}
+
+func TestSyncSkipsListsWithoutChanges(t *testing.T) {
+	f := newFakeFeedly(t, FeedlyList{ID: "tech", Label: "Tech", Type: defaultListType, Entities: keywords("golang", "rust", "zig")})
+	config := testConfig(f.URL)
+
+	result, err := syncFake(t, f, map[string][]string{"Tech": {"rust", "golang"}}, config)
+	if err != nil {
+		t.Fatalf("SyncToFeedly: %v", err)
+	}
+	if len(f.sent()) != 0 {
+		t.Errorf("sent %v for a list that already holds every entry", f.methods())
+	}
+	if result.ListsUpdated != 0 || result.EntitiesAdded != 0 {
+		t.Errorf("got %d updated and %d added, want none", result.ListsUpdated, result.EntitiesAdded)
+	}
+}
+
+func TestSyncLabelMapping(t *testing.T) {
+	f := newFakeFeedly(t, FeedlyList{ID: "technology", Label: "Technology", Type: defaultListType, Entities: keywords("golang")})
+	config := testConfig(f.URL)
+	config.LabelMapping = map[string]string{"KW_TECH_01": "Technology", "KW_FIN_01": "Finance"}
+
+	result, err := syncFake(t, f, map[string][]string{"KW_TECH_01": {"rust"}, "KW_FIN_01": {"stocks"}, "Sports": {"tennis"}}, config)
+	if err != nil {
+		t.Fatalf("SyncToFeedly: %v", err)
+	}
+	if result.ListsCreated != 2 || result.ListsUpdated != 1 {
+		t.Errorf("got %d created and %d updated, want 2 and 1", result.ListsCreated, result.ListsUpdated)
+	}
+	if got, want := fmt.Sprint(f.labels()), "[Finance Sports Technology]"; got != want {
+		t.Errorf("lists = %s, want %s", got, want)
+	}
+	if got := texts(f.list("Technology").Entities); got != "golang,rust" {
+		t.Errorf("Technology holds %s, want golang,rust", got)
+	}
+}
+
+func TestOverflowLabel(t *testing.T) {
+	tests := []struct {
+		format string
+		index  int
+		want   string
+	}{
+		{"{label} {index}", 1, "Tech"},
+		{"{label} {index}", 2, "Tech 2"},
+		{"{label} ({index})", 3, "Tech (3)"},
+		{"{label}_{index:2}", 4, "Tech_04"},
+		{"{index:3}-{label}", 5, "005-Tech"},
+	}
+	for _, test := range tests {
+		if got := overflowLabel("Tech", test.index, test.format); got != test.want {
+			t.Errorf("overflowLabel(%q, %d) = %q, want %q", test.format, test.index, got, test.want)
+		}
+		if test.index > 1 {
+			if got := overflowIndex(test.want, "Tech", test.format); got != test.index {
+				t.Errorf("overflowIndex(%q, %q) = %d, want %d", test.want, test.format, got, test.index)
+			}
+		}
+	}
+}
+
+func TestSyncReusesOverflowListsOfFormat(t *testing.T) {
+	for _, format := range []string{"{label} ({index})", "{label}_{index:2}"} {
+		t.Run(format, func(t *testing.T) {
+			f := newFakeFeedly(t)
+			config := testConfig(f.URL)
+			config.MaxEntitiesPerList = 2
+			config.OverflowLabelFormat = format
+			config.PrefixMatch = true
+
+			if _, err := syncFake(t, f, map[string][]string{"Tech": {"a", "b", "c"}}, config); err != nil {
+				t.Fatalf("first SyncToFeedly: %v", err)
+			}
+			if _, err := syncFake(t, f, map[string][]string{"Tech": {"a", "b", "c", "d", "e"}}, config); err != nil {
+				t.Fatalf("second SyncToFeedly: %v", err)
+			}
+			second, third := overflowLabel("Tech", 2, format), overflowLabel("Tech", 3, format)
+			if got, want := fmt.Sprint(f.labels()), fmt.Sprint([]string{"Tech", second, third}); got != want {
+				t.Fatalf("lists = %s, want %s", got, want)
+			}
+			if got := texts(f.list(second).Entities); got != "c,d" {
+				t.Errorf("%s holds %s, want c,d", second, got)
+			}
+			if got := texts(f.list(third).Entities); got != "e" {
+				t.Errorf("%s holds %s, want e", third, got)
+			}
+		})
+	}
+}
+
+func TestSyncOnlyCreate(t *testing.T) {
+	f := newFakeFeedly(t, FeedlyList{ID: "tech", Label: "Tech", Type: defaultListType, Entities: keywords("golang")})
+	config := testConfig(f.URL)
+	config.OnlyCreate = true
+
+	result, err := syncFake(t, f, map[string][]string{"Tech": {"rust"}, "Finance": {"stocks"}}, config)
+	if err != nil {
+		t.Fatalf("SyncToFeedly: %v", err)
+	}
+	if got := fmt.Sprint(f.methods()); got != "[POST]" {
+		t.Errorf("requests = %s, want only the POST of Finance", got)
+	}
+	if result.ListsCreated != 1 || result.ListsUpdated != 0 {
+		t.Errorf("got %d created and %d updated, want 1 and 0", result.ListsCreated, result.ListsUpdated)
+	}
+	if got := texts(f.list("Tech").Entities); got != "golang" {
+		t.Errorf("Tech holds %s, want golang", got)
+	}
+}
+
+func TestSyncLabelAffixes(t *testing.T) {
+	f := newFakeFeedly(t,
+		FeedlyList{ID: "dev-tech", Label: "[DEV] Tech", Type: defaultListType, Entities: keywords("golang")},
+		FeedlyList{ID: "tech", Label: "Tech", Type: defaultListType, Entities: keywords("golang")},
+	)
+	config := testConfig(f.URL)
+	config.LabelPrefix = "[DEV] "
+
+	if _, err := syncFake(t, f, map[string][]string{"Tech": {"rust"}, "Finance": {"stocks"}}, config); err != nil {
+		t.Fatalf("SyncToFeedly: %v", err)
+	}
+	if got, want := fmt.Sprint(f.labels()), "[Tech [DEV] Finance [DEV] Tech]"; got != want {
+		t.Errorf("lists = %s, want %s", got, want)
+	}
+	if got := texts(f.list("[DEV] Tech").Entities); got != "golang,rust" {
+		t.Errorf("[DEV] Tech holds %s, want golang,rust", got)
+	}
+	if got := texts(f.list("Tech").Entities); got != "golang" {
+		t.Errorf("Tech holds %s, want it untouched", got)
+	}
+
+	config.LabelPrefix, config.LabelSuffix = "", " (prod)"
+	if _, err := syncFake(t, f, map[string][]string{"Tech": {"rust"}}, config); err != nil {
+		t.Fatalf("SyncToFeedly: %v", err)
+	}
+	if _, err := syncFake(t, f, map[string][]string{"Tech": {"rust"}}, config); err != nil {
+		t.Fatalf("SyncToFeedly: %v", err)
+	}
+	if got := texts(f.list("Tech (prod)").Entities); got != "rust" {
+		t.Errorf("Tech (prod) holds %s, want rust", got)
+	}
+	if got := len(f.labels()); got != 4 {
+		t.Errorf("got %d lists after the second run, want 4", got)
+	}
+}
+
+func TestMaxListsPerRun(t *testing.T) {
+	f := newFakeFeedly(t)
+	config := testConfig(f.URL)
+	config.MaxListsPerRun = 1
+
+	_, err := syncFake(t, f, map[string][]string{"Tech": {"golang"}, "Finance": {"stocks"}}, config)
+	if !errors.Is(err, ErrTooManyLists) {
+		t.Errorf("SyncToFeedly = %v, want ErrTooManyLists", err)
+	}
+	if len(f.sent()) != 0 {
+		t.Errorf("sent %v before checking the limit", f.methods())
+	}
+
+	if _, err := syncFake(t, f, map[string][]string{"Tech": {"golang"}, "Empty 1": nil, "Empty 2": nil}, config); err != nil {
+		t.Errorf("SyncToFeedly with empty columns = %v, want them not counted", err)
+	}
+
+	filename := writeFile(t, "data.csv", "Empty 1,Finance,Empty 2\n,stocks,\n")
+	columns, err := NewColumnIterator(context.Background(), []string{filename}, config)
+	if err != nil {
+		t.Fatalf("NewColumnIterator: %v", err)
+	}
+	feedlyData, err := FetchFeedlyData(context.Background(), f.Client(), config)
+	if err != nil {
+		t.Fatalf("FetchFeedlyData: %v", err)
+	}
+	if _, err := SyncColumns(context.Background(), f.Client(), columns, feedlyData, config, nil); err != nil {
+		t.Errorf("SyncColumns with empty columns = %v, want them not counted", err)
+	}
+	if got, want := fmt.Sprint(f.labels()), "[Finance Tech]"; got != want {
+		t.Errorf("lists = %s, want %s", got, want)
+	}
+}
+
+func TestSyncRecordsOrphans(t *testing.T) {
+	f := newFakeFeedly(t, FeedlyList{ID: "tech", Label: "Tech", Type: defaultListType})
+	// Creating lists is refused, so Finance has nowhere to go.
+	f.status = func(r *http.Request, list FeedlyList) int {
+		if r.Method == "POST" {
+			return http.StatusBadRequest
+		}
+		return 0
+	}
+	config := testConfig(f.URL)
+	csvData := map[string][]string{"Tech": {"golang"}, "Finance": {"stocks"}, "Empty": nil}
+
+	result, err := syncFake(t, f, csvData, config)
+	if err == nil || errors.Is(err, ErrOrphanColumns) {
+		t.Errorf("SyncToFeedly = %v, want the failed POST without ErrOrphanColumns", err)
+	}
+	if got := fmt.Sprint(result.Orphans); got != "[Finance]" {
+		t.Errorf("Orphans = %s, want [Finance]", got)
+	}
+	if result.ListsUpdated != 1 {
+		t.Errorf("got %d updated, want Tech synced anyway", result.ListsUpdated)
+	}
+
+	config.FailOnOrphan = true
+	if _, err := syncFake(t, f, csvData, config); !errors.Is(err, ErrOrphanColumns) {
+		t.Errorf("SyncToFeedly with fail_on_orphan = %v, want ErrOrphanColumns", err)
+	}
+}
+
+func TestSyncReportsSharedKeywords(t *testing.T) {
+	f := newFakeFeedly(t)
+	config := testConfig(f.URL)
+	config.SharedKeywordLimit = 2
+	config.DryRun = true
+	csvData := map[string][]string{
+		"Tech":    {"ai", "golang"},
+		"Finance": {"ai", "stocks", "golang"},
+		"Health":  {"ai"},
+	}
+
+	result, err := syncFake(t, f, csvData, config)
+	if err != nil {
+		t.Fatalf("SyncToFeedly: %v", err)
+	}
+	if got, want := fmt.Sprint(result.SharedKeywords), "[{ai [Finance Health Tech]}]"; got != want {
+		t.Errorf("SharedKeywords = %s, want %s", got, want)
+	}
+	if len(result.Plan) != 3 {
+		t.Errorf("got %d planned requests, want the upload unchanged with 3", len(result.Plan))
+	}
+
+	config.SharedKeywordLimit = 0
+	if result, _ := syncFake(t, f, csvData, config); len(result.SharedKeywords) != 0 {
+		t.Errorf("SharedKeywords = %v without a limit, want none", result.SharedKeywords)
+	}
+}
+
+func TestSyncCapColumns(t *testing.T) {
+	f := newFakeFeedly(t)
+	config := testConfig(f.URL)
+	config.MaxRows = 2
+	config.MaxEntitiesPerList = 1
+	csvData := map[string][]string{"Tech": {"a", "b", "c"}}
+
+	_, _, capped := PrepareColumns(csvData, config)
+	result, err := syncFake(t, f, csvData, config)
+	if err != nil {
+		t.Fatalf("SyncToFeedly: %v", err)
+	}
+	result.CapColumns(capped)
+	if got, want := fmt.Sprint(result.Lists), "[{Tech Tech 0 1 0} {Tech 2 Tech 0 1 1}]"; got != want {
+		t.Errorf("Lists = %s, want the cut-off entry on the last list %s", got, want)
+	}
+}